@@ -0,0 +1,338 @@
+package httpx
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+const (
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 1000
+	defaultAdaptiveIdleTimeout  = 10 * time.Minute
+)
+
+// LimitSample describes a single completed attempt.
+type LimitSample struct {
+	RTT      time.Duration
+	InFlight int
+	Dropped  bool
+}
+
+// LimitAlgorithm computes a new concurrency limit from the current limit and
+// the latest sample. A new algorithm instance is created per key, so
+// implementations may keep per-upstream state and are called under a lock.
+type LimitAlgorithm interface {
+	Update(limit int, sample LimitSample) int
+}
+
+// AIMDLimit increases the limit by one while requests succeed and multiplies
+// it by BackoffRatio when a request is dropped or slower than Timeout.
+type AIMDLimit struct {
+	BackoffRatio float64
+	Timeout      time.Duration
+}
+
+// NewAIMDLimit returns an AIMD algorithm backing off by 10% on drops or attempts
+// slower than 5 seconds.
+func NewAIMDLimit() LimitAlgorithm {
+	return &AIMDLimit{BackoffRatio: 0.9, Timeout: 5 * time.Second}
+}
+
+func (a *AIMDLimit) Update(limit int, sample LimitSample) int {
+	if sample.Dropped || (a.Timeout > 0 && sample.RTT > a.Timeout) {
+		return int(float64(limit) * a.BackoffRatio)
+	}
+	// Only grow when the limit is actually being used
+	if sample.InFlight*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// GradientLimit adjusts the limit by the ratio between the long term average
+// latency and the latest sample, so the limit shrinks as soon as latency starts
+// to rise above the baseline and grows while latency stays flat.
+type GradientLimit struct {
+	// Tolerance is how much latency increase is accepted before shrinking the limit
+	Tolerance float64
+	// Smoothing is how much of the newly computed limit is applied per sample
+	Smoothing float64
+
+	longRTT float64
+	samples int
+}
+
+// NewGradientLimit returns a gradient algorithm with a tolerance of 1.5 and a
+// smoothing factor of 0.2.
+func NewGradientLimit() LimitAlgorithm {
+	return &GradientLimit{Tolerance: 1.5, Smoothing: 0.2}
+}
+
+func (g *GradientLimit) Update(limit int, sample LimitSample) int {
+	rtt := float64(sample.RTT)
+	if rtt <= 0 {
+		return limit
+	}
+
+	// Warm up the long term average quickly, then let it decay slowly
+	g.samples++
+	window := math.Min(float64(g.samples), 100)
+	g.longRTT += (rtt - g.longRTT) / window
+
+	gradient := math.Max(0.5, math.Min(1.0, g.Tolerance*g.longRTT/rtt))
+	if sample.Dropped {
+		gradient = 0.5
+	}
+
+	current := float64(limit)
+	queueSize := math.Sqrt(current)
+	if gradient >= 1.0 && sample.InFlight*2 < limit {
+		// The limit is not being used, so latency tells us nothing about it
+		queueSize = 0
+	}
+
+	newLimit := current*gradient + queueSize
+	newLimit = current*(1-g.Smoothing) + newLimit*g.Smoothing
+	return int(math.Round(newLimit))
+}
+
+// AdaptiveLimitOption configures an AdaptiveLimiter.
+type AdaptiveLimitOption func(*AdaptiveLimiter)
+
+// AdaptiveLimitAlgorithm sets the algorithm used for every key (default: NewAIMDLimit).
+func AdaptiveLimitAlgorithm(newAlgorithm func() LimitAlgorithm) AdaptiveLimitOption {
+	return func(l *AdaptiveLimiter) { l.newAlgorithm = newAlgorithm }
+}
+
+// AdaptiveLimitBounds sets the initial, minimum and maximum limit (default: 20, 1, 1000).
+// The minimum is at least 1, so the limit can always recover, and the initial
+// limit is clamped into the bounds.
+func AdaptiveLimitBounds(initial, minLimit, maxLimit int) AdaptiveLimitOption {
+	return func(l *AdaptiveLimiter) {
+		l.initialLimit = initial
+		l.minLimit = minLimit
+		l.maxLimit = maxLimit
+	}
+}
+
+// AdaptiveLimitIdleTimeout sets how long the limit of a key without in-flight
+// requests is kept (default: 10 minutes). The key then starts over from the
+// initial limit, and per-host or per-key limiters do not grow without bound.
+func AdaptiveLimitIdleTimeout(timeout time.Duration) AdaptiveLimitOption {
+	return func(l *AdaptiveLimiter) { l.idleTimeout = timeout }
+}
+
+// AdaptiveLimitPerHost gives every request host its own limit.
+func AdaptiveLimitPerHost() AdaptiveLimitOption {
+	return AdaptiveLimitByKey(func(req *http.Request) string { return req.URL.Host })
+}
+
+// AdaptiveLimitByKey gives every key returned by fn its own limit, e.g. a named upstream.
+func AdaptiveLimitByKey(fn BulkheadKeyFunc) AdaptiveLimitOption {
+	return func(l *AdaptiveLimiter) { l.keyFunc = fn }
+}
+
+// AdaptiveLimiter caps in-flight requests like a Bulkhead, but adjusts the cap
+// from the latency and outcome of every attempt made by the retry loop.
+// Requests over the limit are rejected with ErrBulkheadFull.
+type AdaptiveLimiter struct {
+	initialLimit int
+	minLimit     int
+	maxLimit     int
+	idleTimeout  time.Duration
+	newAlgorithm func() LimitAlgorithm
+	keyFunc      BulkheadKeyFunc
+
+	mu        sync.Mutex
+	states    map[string]*adaptiveState
+	lastSweep time.Time
+}
+
+type adaptiveState struct {
+	limit     int
+	inFlight  int
+	lastUsed  time.Time
+	algorithm LimitAlgorithm
+}
+
+// NewAdaptiveLimiter creates an adaptive concurrency limiter. By default all
+// requests share one limit.
+func NewAdaptiveLimiter(opts ...AdaptiveLimitOption) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		initialLimit: defaultAdaptiveInitialLimit,
+		minLimit:     defaultAdaptiveMinLimit,
+		maxLimit:     defaultAdaptiveMaxLimit,
+		idleTimeout:  defaultAdaptiveIdleTimeout,
+		newAlgorithm: NewAIMDLimit,
+		states:       make(map[string]*adaptiveState),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.minLimit = max(l.minLimit, 1)
+	l.maxLimit = max(l.maxLimit, l.minLimit)
+	l.initialLimit = max(l.minLimit, min(l.maxLimit, l.initialLimit))
+	return l
+}
+
+// Limit returns the current limit for key.
+func (l *AdaptiveLimiter) Limit(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.states[key]; ok {
+		return s.limit
+	}
+	return l.initialLimit
+}
+
+// Limits returns the current limit of every key seen within the idle timeout.
+func (l *AdaptiveLimiter) Limits() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits := make(map[string]int, len(l.states))
+	for key, s := range l.states {
+		limits[key] = s.limit
+	}
+	return limits
+}
+
+// WithAdaptiveConcurrency limits concurrent requests made by the client using l.
+// Attempts failing with a network error or a status the client would retry
+// count as dropped.
+func WithAdaptiveConcurrency(l *AdaptiveLimiter) ClientOption {
+	return func(c *client) {
+		t := &adaptiveTransport{logger: c.Logger, redactor: c.redactor, limiter: l, dropped: c.shouldRetry}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+// acquire takes a slot for key if the limit allows it, returning the number of
+// in-flight requests including this one and the current limit
+func (l *AdaptiveLimiter) acquire(key string) (int, int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	s, ok := l.states[key]
+	if !ok {
+		l.sweep(now)
+		s = &adaptiveState{limit: l.initialLimit, algorithm: l.newAlgorithm()}
+		l.states[key] = s
+	}
+	s.lastUsed = now
+	if s.inFlight >= s.limit {
+		return s.inFlight, s.limit, false
+	}
+	s.inFlight++
+	return s.inFlight, s.limit, true
+}
+
+// sample feeds an attempt into the algorithm and returns the old and new limit
+func (l *AdaptiveLimiter) sample(key string, sample LimitSample) (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.states[key]
+	oldLimit := s.limit
+	newLimit := s.algorithm.Update(s.limit, sample)
+	s.limit = max(l.minLimit, min(l.maxLimit, newLimit))
+	return oldLimit, s.limit
+}
+
+func (l *AdaptiveLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.states[key]
+	s.inFlight--
+	s.lastUsed = time.Now()
+}
+
+// sweep drops the state of keys unused for longer than the idle timeout. It
+// runs at most once per idle timeout.
+func (l *AdaptiveLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for key, s := range l.states {
+		if s.inFlight == 0 && now.Sub(s.lastUsed) >= l.idleTimeout {
+			delete(l.states, key)
+		}
+	}
+}
+
+type adaptiveTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	limiter  *AdaptiveLimiter
+	dropped  func(statusCode int) bool
+}
+
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	key := ""
+	if t.limiter.keyFunc != nil {
+		key = t.limiter.keyFunc(req)
+	}
+
+	inFlight, limit, ok := t.limiter.acquire(key)
+	if !ok {
+		t.logger.WarnContext(ctx, "adaptive concurrency limit rejected request",
+			slog.String("key", key),
+			slog.Int("limit", limit),
+			slog.Int("in_flight", inFlight),
+			slog.String("method", req.Method),
+			slog.String("url", t.redactor.URL(req.URL)),
+		)
+		return nil, ErrBulkheadFull
+	}
+
+	release := func() { t.limiter.release(key) }
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	sample := LimitSample{
+		RTT:      time.Since(start),
+		InFlight: inFlight,
+		// A cancelled caller says nothing about the upstream
+		Dropped: (err != nil && !errors.Is(err, ctx.Err())) || (err == nil && t.dropped(resp.StatusCode)),
+	}
+	if oldLimit, newLimit := t.limiter.sample(key, sample); oldLimit != newLimit {
+		t.logger.DebugContext(ctx, "adaptive concurrency limit changed",
+			slog.String("key", key),
+			slog.Int("old_limit", oldLimit),
+			slog.Int("new_limit", newLimit),
+			slog.Duration("rtt", sample.RTT),
+			slog.Bool("dropped", sample.Dropped),
+		)
+	}
+
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.Body == nil {
+		release()
+		return resp, nil
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
@@ -0,0 +1,185 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestAIMDLimit_Update(t *testing.T) {
+	alg := httpx.NewAIMDLimit()
+
+	if limit := alg.Update(10, httpx.LimitSample{RTT: time.Millisecond, InFlight: 10}); limit != 11 {
+		t.Errorf("expected additive increase to 11, got %d", limit)
+	}
+	if limit := alg.Update(10, httpx.LimitSample{RTT: time.Millisecond, InFlight: 1}); limit != 10 {
+		t.Errorf("expected unused limit to stay at 10, got %d", limit)
+	}
+	if limit := alg.Update(10, httpx.LimitSample{RTT: time.Millisecond, InFlight: 10, Dropped: true}); limit != 9 {
+		t.Errorf("expected multiplicative decrease to 9, got %d", limit)
+	}
+	if limit := alg.Update(10, httpx.LimitSample{RTT: time.Minute, InFlight: 10}); limit != 9 {
+		t.Errorf("expected slow attempt to decrease limit to 9, got %d", limit)
+	}
+}
+
+func TestGradientLimit_Update(t *testing.T) {
+	alg := httpx.NewGradientLimit()
+
+	limit := 20
+	for i := 0; i < 50; i++ {
+		limit = alg.Update(limit, httpx.LimitSample{RTT: 10 * time.Millisecond, InFlight: limit})
+	}
+	if limit <= 20 {
+		t.Errorf("expected limit to grow with flat latency, got %d", limit)
+	}
+
+	grown := limit
+	for i := 0; i < 10; i++ {
+		limit = alg.Update(limit, httpx.LimitSample{RTT: 200 * time.Millisecond, InFlight: limit})
+	}
+	if limit >= grown {
+		t.Errorf("expected limit to shrink when latency rises, got %d (was %d)", limit, grown)
+	}
+}
+
+func TestWithAdaptiveConcurrency_ShrinksOnErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	limiter := httpx.NewAdaptiveLimiter(httpx.AdaptiveLimitBounds(10, 2, 100))
+	client := newTestClient(
+		httpx.WithRetries(5),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithAdaptiveConcurrency(limiter),
+	)
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// Every retried attempt counts as dropped
+	if limit := limiter.Limit(""); limit >= 10 {
+		t.Errorf("expected limit to shrink below 10, got %d", limit)
+	}
+}
+
+func TestNewAdaptiveLimiter_ClampsBounds(t *testing.T) {
+	var unavailable atomic.Bool
+	unavailable.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	limiter := httpx.NewAdaptiveLimiter(httpx.AdaptiveLimitBounds(1, 0, 10))
+	client := newTestClient(httpx.WithAdaptiveConcurrency(limiter))
+
+	// A dropped attempt must not back off to a limit that rejects everything
+	for _, down := range []bool{true, false} {
+		unavailable.Store(down)
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected request to be allowed, got %v", err)
+		}
+		resp.Body.Close()
+	}
+	if limit := limiter.Limit(""); limit < 1 {
+		t.Errorf("expected limit of at least 1, got %d", limit)
+	}
+
+	if limit := httpx.NewAdaptiveLimiter(httpx.AdaptiveLimitBounds(50, 1, 10)).Limit(""); limit != 10 {
+		t.Errorf("expected initial limit to be clamped to 10, got %d", limit)
+	}
+	if limit := httpx.NewAdaptiveLimiter(httpx.AdaptiveLimitBounds(0, -5, 10)).Limit(""); limit != 1 {
+		t.Errorf("expected initial limit to be clamped to 1, got %d", limit)
+	}
+}
+
+func TestWithAdaptiveConcurrency_RejectsOverLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limiter := httpx.NewAdaptiveLimiter(
+		httpx.AdaptiveLimitBounds(1, 1, 1),
+		httpx.AdaptiveLimitPerHost(),
+	)
+	client := newTestClient(httpx.WithAdaptiveConcurrency(limiter))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	first, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(context.Background(), req); !errors.Is(err, httpx.ErrBulkheadFull) {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+
+	first.Body.Close()
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected slot to be released, got %v", err)
+	}
+	resp.Body.Close()
+
+	if _, ok := limiter.Limits()[req.URL.Host]; !ok {
+		t.Error("expected limit to be tracked per host")
+	}
+}
+
+func TestWithAdaptiveConcurrency_DropsIdleKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiter := httpx.NewAdaptiveLimiter(
+		httpx.AdaptiveLimitByKey(func(req *http.Request) string { return req.Header.Get("X-Tenant") }),
+		httpx.AdaptiveLimitIdleTimeout(50*time.Millisecond),
+	)
+	client := newTestClient(httpx.WithAdaptiveConcurrency(limiter))
+
+	get := func(tenant string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("X-Tenant", tenant)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	// a finishes and goes idle, b keeps its request in flight
+	get("a").Body.Close()
+	held := get("b")
+	defer held.Body.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	get("c").Body.Close()
+
+	limits := limiter.Limits()
+	if _, ok := limits["a"]; ok {
+		t.Errorf("expected idle key to be dropped, got %v", limits)
+	}
+	if _, ok := limits["b"]; !ok || len(limits) != 2 {
+		t.Errorf("expected keys in use to be kept, got %v", limits)
+	}
+}
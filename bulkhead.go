@@ -0,0 +1,270 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// defaultBulkheadIdleTimeout is how long an unused compartment is kept
+const defaultBulkheadIdleTimeout = 10 * time.Minute
+
+// ErrBulkheadFull is returned when a request is rejected because its
+// compartment has no free slot and no room left in the wait queue, or the
+// request waited in the queue for longer than the queue timeout.
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// BulkheadKeyFunc extracts the compartment a request belongs to, e.g. a named upstream.
+type BulkheadKeyFunc func(req *http.Request) string
+
+// BulkheadOption configures a Bulkhead.
+type BulkheadOption func(*Bulkhead)
+
+// BulkheadPerHost gives every request host its own compartment.
+func BulkheadPerHost() BulkheadOption {
+	return BulkheadByKey(func(req *http.Request) string { return req.URL.Host })
+}
+
+// BulkheadByKey gives every key returned by fn its own compartment.
+func BulkheadByKey(fn BulkheadKeyFunc) BulkheadOption {
+	return func(b *Bulkhead) { b.keyFunc = fn }
+}
+
+// BulkheadQueue lets up to size requests wait for a free slot, each for at most
+// timeout. A zero timeout waits until the request context is done.
+func BulkheadQueue(size int, timeout time.Duration) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.queueSize = size
+		b.queueTimeout = timeout
+	}
+}
+
+// BulkheadIdleTimeout sets how long a compartment without in-flight or queued
+// requests is kept, along with its stats (default: 10 minutes). Dropping idle
+// compartments keeps per-host or per-key bulkheads from growing without bound.
+func BulkheadIdleTimeout(timeout time.Duration) BulkheadOption {
+	return func(b *Bulkhead) { b.idleTimeout = timeout }
+}
+
+// BulkheadStats is a snapshot of a single bulkhead compartment.
+type BulkheadStats struct {
+	InFlight int
+	Queued   int
+	Rejected uint64
+}
+
+// Bulkhead caps the number of in-flight requests per compartment. A slot is
+// held until the response body is closed, so slow consumers count as in-flight.
+type Bulkhead struct {
+	maxConcurrent int
+	queueSize     int
+	queueTimeout  time.Duration
+	idleTimeout   time.Duration
+	keyFunc       BulkheadKeyFunc
+
+	mu           sync.Mutex
+	compartments map[string]*compartment
+	lastSweep    time.Time
+}
+
+// NewBulkhead creates a bulkhead allowing maxConcurrent in-flight requests per
+// compartment, at least 1. By default all requests share one compartment.
+func NewBulkhead(maxConcurrent int, opts ...BulkheadOption) *Bulkhead {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	b := &Bulkhead{
+		maxConcurrent: maxConcurrent,
+		idleTimeout:   defaultBulkheadIdleTimeout,
+		compartments:  make(map[string]*compartment),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Stats returns a snapshot of every compartment keyed by compartment name.
+// Compartments dropped after the idle timeout are not included.
+func (b *Bulkhead) Stats() map[string]BulkheadStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make(map[string]BulkheadStats, len(b.compartments))
+	for key, c := range b.compartments {
+		stats[key] = BulkheadStats{
+			InFlight: len(c.slots),
+			Queued:   int(c.queued.Load()),
+			Rejected: c.rejected.Load(),
+		}
+	}
+	return stats
+}
+
+// WithBulkhead limits concurrent requests made by the client using b. The same
+// bulkhead can be shared by several clients.
+func WithBulkhead(b *Bulkhead) ClientOption {
+	return func(c *client) {
+		log, redactor := c.Logger, c.redactor
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			return &bulkheadTransport{next: next, logger: log, redactor: redactor, bulkhead: b}
+		})
+	}
+}
+
+func (b *Bulkhead) key(req *http.Request) string {
+	if b.keyFunc == nil {
+		return ""
+	}
+	return b.keyFunc(req)
+}
+
+// compartment returns the compartment for key, creating it on first use. The
+// compartment is kept until done is called.
+func (b *Bulkhead) compartment(key string) *compartment {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	c, ok := b.compartments[key]
+	if !ok {
+		b.sweep(now)
+		c = &compartment{slots: make(chan struct{}, b.maxConcurrent)}
+		b.compartments[key] = c
+	}
+	c.users++
+	c.lastUsed = now
+	return c
+}
+
+func (b *Bulkhead) done(c *compartment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c.users--
+	c.lastUsed = time.Now()
+}
+
+// sweep drops compartments unused for longer than the idle timeout. It runs
+// at most once per idle timeout.
+func (b *Bulkhead) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.idleTimeout {
+		return
+	}
+	b.lastSweep = now
+
+	for key, c := range b.compartments {
+		if c.users == 0 && now.Sub(c.lastUsed) >= b.idleTimeout {
+			delete(b.compartments, key)
+		}
+	}
+}
+
+type compartment struct {
+	slots    chan struct{}
+	queued   atomic.Int32
+	rejected atomic.Uint64
+
+	// users and lastUsed are guarded by the mutex of the Bulkhead
+	users    int
+	lastUsed time.Time
+}
+
+// acquire takes a slot, waiting in the queue if the bulkhead allows it
+func (b *Bulkhead) acquire(ctx context.Context, c *compartment) error {
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if int(c.queued.Add(1)) > b.queueSize {
+		c.queued.Add(-1)
+		c.rejected.Add(1)
+		return ErrBulkheadFull
+	}
+	defer c.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if b.queueTimeout > 0 {
+		timer := time.NewTimer(b.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		c.rejected.Add(1)
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type bulkheadTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	bulkhead *Bulkhead
+}
+
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	key := t.bulkhead.key(req)
+	c := t.bulkhead.compartment(key)
+
+	if err := t.bulkhead.acquire(ctx, c); err != nil {
+		t.bulkhead.done(c)
+		if errors.Is(err, ErrBulkheadFull) {
+			t.logger.WarnContext(ctx, "bulkhead rejected request",
+				slog.String("key", key),
+				slog.Int("max_concurrent", t.bulkhead.maxConcurrent),
+				slog.Int("queue_size", t.bulkhead.queueSize),
+				slog.Uint64("rejected", c.rejected.Load()),
+				slog.String("method", req.Method),
+				slog.String("url", t.redactor.URL(req.URL)),
+			)
+		}
+		return nil, err
+	}
+
+	release := func() {
+		<-c.slots
+		t.bulkhead.done(c)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.Body == nil {
+		release()
+		return resp, nil
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnClose runs release once when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
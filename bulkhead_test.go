@@ -0,0 +1,201 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func newBulkheadServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestWithBulkhead_RejectsWhenFull(t *testing.T) {
+	server := newBulkheadServer()
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	bulkhead := httpx.NewBulkhead(1)
+	client := httpx.New(log, httpx.WithBulkhead(bulkhead))
+
+	// The first response keeps its slot until the body is closed
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	first, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	_, err = client.Do(context.Background(), req)
+	if !errors.Is(err, httpx.ErrBulkheadFull) {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+
+	if !strings.Contains(logBuf.String(), "bulkhead rejected request") {
+		t.Error("expected rejection to be logged")
+	}
+
+	stats := bulkhead.Stats()[""]
+	if stats.InFlight != 1 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	first.Body.Close()
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected slot to be released after closing body, got %v", err)
+	}
+	resp.Body.Close()
+
+	if stats := bulkhead.Stats()[""]; stats.InFlight != 0 {
+		t.Errorf("expected no in-flight requests, got %d", stats.InFlight)
+	}
+}
+
+func TestNewBulkhead_NonPositiveLimit(t *testing.T) {
+	server := newBulkheadServer()
+	defer server.Close()
+
+	for _, limit := range []int{0, -1} {
+		bulkhead := httpx.NewBulkhead(limit)
+		client := newTestClient(httpx.WithBulkhead(bulkhead))
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		first, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("limit %d: expected one request to be allowed, got %v", limit, err)
+		}
+
+		req, _ = http.NewRequest("GET", server.URL, nil)
+		if _, err := client.Do(context.Background(), req); !errors.Is(err, httpx.ErrBulkheadFull) {
+			t.Errorf("limit %d: expected ErrBulkheadFull for a second request, got %v", limit, err)
+		}
+		first.Body.Close()
+	}
+}
+
+func TestWithBulkhead_QueueWaitsForSlot(t *testing.T) {
+	server := newBulkheadServer()
+	defer server.Close()
+
+	client := newTestClient(httpx.WithBulkhead(httpx.NewBulkhead(1, httpx.BulkheadQueue(1, time.Second))))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	first, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first.Body.Close()
+	}()
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected queued request to succeed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestWithBulkhead_QueueTimeout(t *testing.T) {
+	server := newBulkheadServer()
+	defer server.Close()
+
+	client := newTestClient(httpx.WithBulkhead(httpx.NewBulkhead(1, httpx.BulkheadQueue(1, 50*time.Millisecond))))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	first, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer first.Body.Close()
+
+	start := time.Now()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	_, err = client.Do(context.Background(), req)
+	if !errors.Is(err, httpx.ErrBulkheadFull) {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+	if duration := time.Since(start); duration < 40*time.Millisecond {
+		t.Errorf("expected request to wait in the queue, took %v", duration)
+	}
+}
+
+func TestWithBulkhead_PerHost(t *testing.T) {
+	server1 := newBulkheadServer()
+	defer server1.Close()
+	server2 := newBulkheadServer()
+	defer server2.Close()
+
+	bulkhead := httpx.NewBulkhead(1, httpx.BulkheadPerHost())
+	client := newTestClient(httpx.WithBulkhead(bulkhead))
+
+	for _, url := range []string{server1.URL, server2.URL} {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected separate compartments per host, got %v", err)
+		}
+		defer resp.Body.Close()
+	}
+
+	if n := len(bulkhead.Stats()); n != 2 {
+		t.Errorf("expected 2 compartments, got %d", n)
+	}
+}
+
+func TestWithBulkhead_DropsIdleCompartments(t *testing.T) {
+	server1 := newBulkheadServer()
+	defer server1.Close()
+	server2 := newBulkheadServer()
+	defer server2.Close()
+	server3 := newBulkheadServer()
+	defer server3.Close()
+
+	bulkhead := httpx.NewBulkhead(1, httpx.BulkheadPerHost(), httpx.BulkheadIdleTimeout(50*time.Millisecond))
+	client := newTestClient(httpx.WithBulkhead(bulkhead))
+
+	get := func(url string) *http.Response {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	// server1 finishes and goes idle, server2 keeps its slot
+	get(server1.URL).Body.Close()
+	held := get(server2.URL)
+	defer held.Body.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	get(server3.URL).Body.Close()
+
+	stats := bulkhead.Stats()
+	if _, ok := stats[strings.TrimPrefix(server1.URL, "http://")]; ok {
+		t.Errorf("expected idle compartment to be dropped, got %v", stats)
+	}
+	if s, ok := stats[strings.TrimPrefix(server2.URL, "http://")]; !ok || s.InFlight != 1 {
+		t.Errorf("expected compartment in use to be kept, got %v", stats)
+	}
+	if len(stats) != 2 {
+		t.Errorf("expected 2 compartments, got %v", stats)
+	}
+}
@@ -0,0 +1,513 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+const defaultCacheMaxEntrySize = 10 * 1024 * 1024 // 10MB
+
+// cacheableStatus lists the status codes that are heuristically cacheable (RFC 9110 §15.1)
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// CacheOption configures the cache created by WithCache.
+type CacheOption func(*cacheTransport)
+
+// CacheMaxEntrySize sets the largest response body that is stored (default: 10MB).
+func CacheMaxEntrySize(size int64) CacheOption {
+	return func(t *cacheTransport) { t.maxEntrySize = size }
+}
+
+// WithCache adds a private HTTP cache following RFC 9111. GET responses are
+// stored in store and served while fresh according to Cache-Control, Expires
+// or a Last-Modified heuristic. Stale entries are revalidated with conditional
+// requests using ETag and Last-Modified, and stale-while-revalidate and
+// stale-if-error are honoured. Successful unsafe requests invalidate the
+// cached entry for their URL.
+//
+// Since one client is often shared by several users, responses to requests
+// with an Authorization header are only stored when the response allows a
+// shared cache to reuse them (RFC 9111 §3.5).
+func WithCache(store CacheStore, opts ...CacheOption) ClientOption {
+	return func(c *client) {
+		t := &cacheTransport{
+			logger:       c.Logger,
+			redactor:     c.redactor,
+			store:        store,
+			maxEntrySize: defaultCacheMaxEntrySize,
+		}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type cacheTransport struct {
+	next         http.RoundTripper
+	logger       *slog.Logger
+	redactor     *logger.Redactor
+	store        CacheStore
+	maxEntrySize int64
+
+	// revalidating tracks background revalidations so a burst of stale hits
+	// only triggers one of them per key
+	revalidating sync.Map
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.passThrough(req)
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") {
+		return t.next.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := loadCacheEntry(t.store, key)
+	if entry != nil && !entry.matchesVary(req) {
+		entry = nil
+	}
+
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			t.logOutcome(req, "miss", http.StatusGatewayTimeout)
+			return gatewayTimeoutResponse(req), nil
+		}
+		return t.fetch(req, key, "miss")
+	}
+
+	now := time.Now()
+	respCC := parseCacheControl(entry.Header)
+	age := entry.age(now)
+	lifetime := entry.freshnessLifetime()
+	if maxAge, ok := reqCC.seconds("max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	noCache := reqCC.has("no-cache") || respCC.has("no-cache")
+
+	if !noCache && age < lifetime {
+		resp := entry.response(req, now)
+		t.logOutcome(req, "hit", resp.StatusCode)
+		return resp, nil
+	}
+
+	staleness := age - lifetime
+	if !noCache && !respCC.has("must-revalidate") {
+		if window, ok := respCC.seconds("stale-while-revalidate"); ok && staleness < window {
+			t.revalidateInBackground(req, key, entry)
+			resp := entry.response(req, now)
+			t.logOutcome(req, "stale", resp.StatusCode)
+			return resp, nil
+		}
+	}
+
+	return t.revalidate(req, key, entry, staleness)
+}
+
+// passThrough forwards requests the cache does not serve and invalidates the
+// cached entry after a successful unsafe request (RFC 9111 §4.4)
+func (t *cacheTransport) passThrough(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+	default:
+		if resp.StatusCode < 400 {
+			t.store.Delete(cacheKey(req))
+		}
+	}
+	return resp, nil
+}
+
+// fetch forwards req and stores the response if it is cacheable
+func (t *cacheTransport) fetch(req *http.Request, key, outcome string) (*http.Response, error) {
+	requestTime := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.logOutcome(req, outcome, resp.StatusCode)
+	return t.storeResponse(req, key, resp, requestTime)
+}
+
+// revalidate sends a conditional request for a stale entry
+func (t *cacheTransport) revalidate(req *http.Request, key string, entry *cacheEntry, staleness time.Duration) (*http.Response, error) {
+	condReq := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := time.Now()
+	resp, err := t.next.RoundTrip(condReq)
+
+	if err != nil || resp.StatusCode >= 500 {
+		if t.canServeStaleOnError(req, entry, staleness) {
+			if resp != nil {
+				_ = resp.Body.Close()
+			}
+			stale := entry.response(req, time.Now())
+			t.logOutcome(req, "stale-if-error", stale.StatusCode)
+			return stale, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		entry.refresh(resp.Header, requestTime, time.Now())
+		entry.save(t.store, key)
+
+		fresh := entry.response(req, time.Now())
+		t.logOutcome(req, "revalidated", fresh.StatusCode)
+		return fresh, nil
+	}
+
+	t.logOutcome(req, "miss", resp.StatusCode)
+	return t.storeResponse(req, key, resp, requestTime)
+}
+
+func (t *cacheTransport) revalidateInBackground(req *http.Request, key string, entry *cacheEntry) {
+	if _, running := t.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	// The caller is served from the cache, so the revalidation must outlive it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), defaultHTTPTimeout)
+	bgReq := req.Clone(ctx)
+
+	go func() {
+		defer cancel()
+		defer t.revalidating.Delete(key)
+
+		resp, err := t.revalidate(bgReq, key, entry, 0)
+		if err != nil {
+			t.logger.WarnContext(ctx, "background cache revalidation failed",
+				slog.String("url", t.redactor.URL(bgReq.URL)),
+				slog.Any("error", t.redactor.Error(err)),
+			)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+}
+
+func (t *cacheTransport) canServeStaleOnError(req *http.Request, entry *cacheEntry, staleness time.Duration) bool {
+	respCC := parseCacheControl(entry.Header)
+	if respCC.has("must-revalidate") {
+		return false
+	}
+	for _, cc := range []cacheControl{parseCacheControl(req.Header), respCC} {
+		if window, ok := cc.seconds("stale-if-error"); ok && staleness < window {
+			return true
+		}
+	}
+	return false
+}
+
+// storeResponse buffers and stores resp if it is cacheable, returning a
+// response the caller can read
+func (t *cacheTransport) storeResponse(req *http.Request, key string, resp *http.Response, requestTime time.Time) (*http.Response, error) {
+	if !isCacheable(req, resp) {
+		return resp, nil
+	}
+	if resp.ContentLength > t.maxEntrySize {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.maxEntrySize+1))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(body)) > t.maxEntrySize {
+		// Too large to cache, hand the rest of the body through untouched
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	entry := newCacheEntry(req, resp, body, requestTime, time.Now())
+	entry.save(t.store, key)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (t *cacheTransport) logOutcome(req *http.Request, outcome string, status int) {
+	t.logger.InfoContext(req.Context(), "http cache",
+		slog.String("cache", outcome),
+		slog.String("method", req.Method),
+		slog.String("url", t.redactor.URL(req.URL)),
+		slog.Int("status", status),
+	)
+}
+
+// isCacheable reports whether resp may be stored (RFC 9111 §3)
+func isCacheable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet || !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+	if parseCacheControl(req.Header).has("no-store") {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if respCC.has("no-store") || strings.TrimSpace(resp.Header.Get("Vary")) == "*" {
+		return false
+	}
+	if !allowsAuthorizedReuse(req, respCC) {
+		return false
+	}
+	// Without explicit freshness or a validator the entry would never be usable
+	_, hasMaxAge := respCC.seconds("max-age")
+	return hasMaxAge ||
+		respCC.has("no-cache") ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// allowsAuthorizedReuse reports whether a response to req may be served to
+// other requests, which for a request with an Authorization header requires
+// the response to say so explicitly (RFC 9111 §3.5)
+func allowsAuthorizedReuse(req *http.Request, respCC cacheControl) bool {
+	if req.Header.Get("Authorization") == "" {
+		return true
+	}
+	return respCC.has("public") || respCC.has("s-maxage") || respCC.has("must-revalidate")
+}
+
+func cacheKey(req *http.Request) string {
+	return http.MethodGet + " " + req.URL.String()
+}
+
+func gatewayTimeoutResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout)),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// cacheEntry is a stored response together with the metadata needed to
+// compute its age and match it against later requests
+type cacheEntry struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+	// VaryHeader holds the request header values selected by the Vary header
+	VaryHeader http.Header `json:"vary_header,omitempty"`
+}
+
+func newCacheEntry(req *http.Request, resp *http.Response, body []byte, requestTime, responseTime time.Time) *cacheEntry {
+	entry := &cacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if entry.VaryHeader == nil {
+			entry.VaryHeader = make(http.Header)
+		}
+		entry.VaryHeader[name] = req.Header.Values(name)
+	}
+	return entry
+}
+
+func loadCacheEntry(store CacheStore, key string) *cacheEntry {
+	data, ok := store.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		store.Delete(key)
+		return nil
+	}
+	return &entry
+}
+
+func (e *cacheEntry) save(store CacheStore, key string) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	store.Set(key, data)
+}
+
+// matchesVary reports whether req selects the same variant as the stored request
+func (e *cacheEntry) matchesVary(req *http.Request) bool {
+	for _, name := range varyHeaders(e.Header) {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(e.VaryHeader.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh updates the entry with the headers of a 304 response (RFC 9111 §4.3.4)
+func (e *cacheEntry) refresh(header http.Header, requestTime, responseTime time.Time) {
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		e.Header[name] = values
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// freshnessLifetime implements RFC 9111 §4.2.1 including the 10% heuristic
+func (e *cacheEntry) freshnessLifetime() time.Duration {
+	if maxAge, ok := parseCacheControl(e.Header).seconds("max-age"); ok {
+		return maxAge
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires means already expired
+			return 0
+		}
+		return t.Sub(e.date())
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		return e.date().Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// age implements RFC 9111 §4.2.3
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := max(0, e.ResponseTime.Sub(e.date()))
+
+	var ageValue time.Duration
+	if secs, err := strconv.Atoi(e.Header.Get("Age")); err == nil && secs > 0 {
+		ageValue = time.Duration(secs) * time.Second
+	}
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+
+	return max(apparentAge, correctedAge) + now.Sub(e.ResponseTime)
+}
+
+// response builds a response for req from the entry
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.age(now).Seconds())))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" && name != "*" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cacheControl holds the directives of a Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(value)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
@@ -0,0 +1,335 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func doGet(t *testing.T, client httpx.Client, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", url, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestWithCache_FreshHit(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("cached"))
+	}))
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	client := httpx.New(log, httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	resp, body := doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&callCount); n != 1 {
+		t.Errorf("expected 1 upstream call, got %d", n)
+	}
+	if body != "cached" {
+		t.Errorf("expected cached body, got '%s'", body)
+	}
+	if resp.Header.Get("Age") == "" {
+		t.Error("expected Age header on cached response")
+	}
+
+	logs := logBuf.String()
+	if !strings.Contains(logs, `"cache":"miss"`) || !strings.Contains(logs, `"cache":"hit"`) {
+		t.Errorf("expected miss and hit to be logged, got: %s", logs)
+	}
+}
+
+func TestWithCache_Authorization(t *testing.T) {
+	testCases := []struct {
+		cacheControl string
+		wantCalls    int32
+	}{
+		{"max-age=60", 2},
+		{"private, max-age=60", 2},
+		{"public, max-age=60", 1},
+		{"s-maxage=60, max-age=60", 1},
+		{"must-revalidate, max-age=60", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cacheControl, func(t *testing.T) {
+			var callCount int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&callCount, 1)
+				w.Header().Set("Cache-Control", tc.cacheControl)
+				w.Write([]byte("data for " + r.Header.Get("Authorization")))
+			}))
+			defer server.Close()
+
+			client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+			doGet(t, client, server.URL, http.Header{"Authorization": {"Bearer alice"}})
+			_, body := doGet(t, client, server.URL, http.Header{"Authorization": {"Bearer bob"}})
+
+			if n := atomic.LoadInt32(&callCount); n != tc.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tc.wantCalls, n)
+			}
+			if tc.wantCalls == 2 && body != "data for Bearer bob" {
+				t.Errorf("expected a response for bob, got '%s'", body)
+			}
+		})
+	}
+}
+
+func TestWithCache_NoStore(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+}
+
+func TestWithCache_ExpiredInPast(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.Header().Set("Expires", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.Write([]byte("expired"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+}
+
+func TestWithCache_RevalidatesWithETag(t *testing.T) {
+	var callCount, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("original"))
+	}))
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	client := httpx.New(log, httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	resp, body := doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+	if atomic.LoadInt32(&notModified) != 1 {
+		t.Error("expected a conditional request answered with 304")
+	}
+	if resp.StatusCode != http.StatusOK || body != "original" {
+		t.Errorf("expected cached 200 'original', got %d '%s'", resp.StatusCode, body)
+	}
+	if !strings.Contains(logBuf.String(), `"cache":"revalidated"`) {
+		t.Error("expected revalidation to be logged")
+	}
+}
+
+func TestWithCache_RevalidatesWithLastModified(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	var notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified)
+		w.Header().Set("Cache-Control", "max-age=0")
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("original"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	_, body := doGet(t, client, server.URL, nil)
+
+	if atomic.LoadInt32(&notModified) != 1 {
+		t.Error("expected a conditional request answered with 304")
+	}
+	if body != "original" {
+		t.Errorf("expected cached body, got '%s'", body)
+	}
+}
+
+func TestWithCache_Vary(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	_, body := doGet(t, client, server.URL, http.Header{"Accept-Language": {"en"}})
+	if body != "en" {
+		t.Errorf("expected 'en', got '%s'", body)
+	}
+	_, body = doGet(t, client, server.URL, http.Header{"Accept-Language": {"th"}})
+	if body != "th" {
+		t.Errorf("expected 'th', got '%s'", body)
+	}
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+}
+
+func TestWithCache_StaleWhileRevalidate(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&callCount, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		if n == 1 {
+			w.Write([]byte("v1"))
+			return
+		}
+		w.Write([]byte("v2"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	_, body := doGet(t, client, server.URL, nil)
+	if body != "v1" {
+		t.Errorf("expected stale 'v1' to be served immediately, got '%s'", body)
+	}
+
+	// The background revalidation stores the new version
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&callCount) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	_, body = doGet(t, client, server.URL, nil)
+	if body != "v2" {
+		t.Errorf("expected revalidated 'v2', got '%s'", body)
+	}
+}
+
+func TestWithCache_StaleIfError(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Write([]byte("last good"))
+	}))
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	client := httpx.New(log, httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+	failing.Store(true)
+	resp, body := doGet(t, client, server.URL, nil)
+
+	if resp.StatusCode != http.StatusOK || body != "last good" {
+		t.Errorf("expected stale 200 'last good', got %d '%s'", resp.StatusCode, body)
+	}
+	if !strings.Contains(logBuf.String(), `"cache":"stale-if-error"`) {
+		t.Error("expected stale-if-error to be logged")
+	}
+}
+
+func TestWithCache_UnsafeMethodInvalidates(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&callCount, 1)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, nil)
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("update"))
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected PUT to invalidate the cached entry, got %d GET calls", n)
+	}
+}
+
+func TestWithCache_OnlyIfCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithCache(httpx.NewMemoryCacheStore(0)))
+
+	resp, _ := doGet(t, client, server.URL, http.Header{"Cache-Control": {"only-if-cached"}})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for only-if-cached miss, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const defaultMemoryCacheEntries = 1000
+
+// CacheStore persists serialized cache entries. Implementations must be safe
+// for concurrent use.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCacheStore is an in-memory CacheStore evicting the least recently
+// used entry once it holds maxEntries entries.
+type MemoryCacheStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStore creates an LRU store holding up to maxEntries entries.
+// A non-positive maxEntries uses the default of 1000.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryCacheEntries
+	}
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*memoryCacheItem).value, true
+}
+
+func (s *MemoryCacheStore) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).value = value
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	s.entries[key] = s.lru.PushFront(&memoryCacheItem{key: key, value: value})
+	for s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+	}
+}
+
+// Len returns the number of entries in the store.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lru.Len()
+}
+
+// DiskCacheStore is a CacheStore keeping one file per entry in a directory,
+// so cached responses survive restarts.
+type DiskCacheStore struct {
+	dir string
+}
+
+// NewDiskCacheStore creates a store in dir, creating the directory if needed.
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCacheStore{dir: dir}, nil
+}
+
+func (s *DiskCacheStore) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *DiskCacheStore) Set(key string, value []byte) {
+	// Write to a temporary file first so readers never see a partial entry
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+func (s *DiskCacheStore) Delete(key string) {
+	_ = os.Remove(s.path(key))
+}
+
+// path maps a key to a file name that is safe on every file system
+func (s *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,62 @@
+package httpx_test
+
+import (
+	"testing"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(2)
+
+	store.Set("a", []byte("1"))
+	store.Set("b", []byte("2"))
+
+	// Touch "a" so "b" becomes the least recently used entry
+	if value, ok := store.Get("a"); !ok || string(value) != "1" {
+		t.Fatalf("expected 'a' to be stored, got %q %v", value, ok)
+	}
+
+	store.Set("c", []byte("3"))
+
+	if _, ok := store.Get("b"); ok {
+		t.Error("expected 'b' to be evicted")
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Error("expected 'a' to survive eviction")
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", store.Len())
+	}
+
+	store.Delete("a")
+	if _, ok := store.Get("a"); ok {
+		t.Error("expected 'a' to be deleted")
+	}
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := httpx.NewDiskCacheStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store.Set("GET https://example.com/a?b=c", []byte("entry"))
+
+	// A new store on the same directory sees entries written before a restart
+	reopened, err := httpx.NewDiskCacheStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, ok := reopened.Get("GET https://example.com/a?b=c")
+	if !ok || string(value) != "entry" {
+		t.Fatalf("expected persisted entry, got %q %v", value, ok)
+	}
+
+	reopened.Delete("GET https://example.com/a?b=c")
+	if _, ok := store.Get("GET https://example.com/a?b=c"); ok {
+		t.Error("expected entry to be deleted")
+	}
+}
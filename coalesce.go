@@ -0,0 +1,144 @@
+package httpx
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// coalescingCredentialHeaders are always part of the coalescing key, so that
+// callers never receive a response meant for other credentials
+var coalescingCredentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// WithRequestCoalescing makes identical GET and HEAD requests that are in
+// flight at the same time share a single upstream call. Requests are identical
+// when their method, URL, credentials and the values of headers are equal.
+// Every caller receives its own copy of the response with an independently
+// readable body.
+//
+// The shared call runs with the context of the request that started it, so if
+// that caller gives up the other callers receive its error.
+func WithRequestCoalescing(headers ...string) ClientOption {
+	return func(c *client) {
+		t := &coalescingTransport{
+			logger:   c.Logger,
+			redactor: c.redactor,
+			headers:  headers,
+			calls:    make(map[string]*coalescedCall),
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type coalescingTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	headers  []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is an upstream call shared by several callers
+type coalescedCall struct {
+	done    chan struct{}
+	resp    *http.Response
+	body    []byte
+	err     error
+	callers int
+}
+
+func (t *coalescingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	key := t.key(req)
+
+	t.mu.Lock()
+	if call, ok := t.calls[key]; ok {
+		call.callers++
+		t.mu.Unlock()
+
+		t.logger.DebugContext(ctx, "coalescing request with in-flight call",
+			slog.String("method", req.Method),
+			slog.String("url", t.redactor.URL(req.URL)),
+		)
+
+		select {
+		case <-call.done:
+			return call.response(req)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &coalescedCall{done: make(chan struct{}), callers: 1}
+	t.calls[key] = call
+	t.mu.Unlock()
+
+	call.resp, call.err = t.next.RoundTrip(req)
+	if call.err == nil && call.resp.Body != nil {
+		call.body, call.err = io.ReadAll(call.resp.Body)
+		_ = call.resp.Body.Close()
+	}
+
+	t.mu.Lock()
+	delete(t.calls, key)
+	callers := call.callers
+	t.mu.Unlock()
+	close(call.done)
+
+	if callers > 1 {
+		t.logger.DebugContext(ctx, "coalesced requests shared one upstream call",
+			slog.String("method", req.Method),
+			slog.String("url", t.redactor.URL(req.URL)),
+			slog.Int("callers", callers),
+		)
+	}
+
+	return call.response(req)
+}
+
+// key identifies requests that can share an upstream call
+func (t *coalescingTransport) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+	for _, name := range slices.Concat(coalescingCredentialHeaders, t.headers) {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// response returns a copy of the shared response for req
+func (c *coalescedCall) response(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(c.body))
+	if req.Method != http.MethodHead {
+		resp.ContentLength = int64(len(c.body))
+	}
+	resp.Request = req
+	return &resp, nil
+}
@@ -0,0 +1,160 @@
+package httpx_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func newSlowServer(callCount *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(callCount, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("X-Lang", r.Header.Get("Accept-Language"))
+		w.Write([]byte("payload"))
+	}))
+}
+
+func doConcurrently(t *testing.T, client httpx.Client, n int, newReq func(i int) *http.Request) []string {
+	t.Helper()
+
+	bodies := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Do(context.Background(), newReq(i))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			bodies[i] = string(body)
+		}(i)
+	}
+	wg.Wait()
+	return bodies
+}
+
+func TestWithRequestCoalescing_SharesUpstreamCall(t *testing.T) {
+	var callCount int32
+	server := newSlowServer(&callCount)
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRequestCoalescing())
+
+	bodies := doConcurrently(t, client, 10, func(int) *http.Request {
+		req, _ := http.NewRequest("GET", server.URL+"/resource", nil)
+		return req
+	})
+
+	if n := atomic.LoadInt32(&callCount); n != 1 {
+		t.Errorf("expected 1 upstream call, got %d", n)
+	}
+	// Every caller must be able to read the full body independently
+	for i, body := range bodies {
+		if body != "payload" {
+			t.Errorf("caller %d: expected body 'payload', got '%s'", i, body)
+		}
+	}
+}
+
+func TestWithRequestCoalescing_SelectedHeaders(t *testing.T) {
+	var callCount int32
+	server := newSlowServer(&callCount)
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRequestCoalescing("Accept-Language"))
+
+	langs := []string{"en", "th", "en", "th"}
+	doConcurrently(t, client, len(langs), func(i int) *http.Request {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept-Language", langs[i])
+		return req
+	})
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 1 upstream call per language, got %d", n)
+	}
+}
+
+func TestWithRequestCoalescing_CredentialsNotShared(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("data for " + r.Header.Get("Authorization") + r.Header.Get("Cookie")))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRequestCoalescing())
+
+	credentials := []struct{ header, value string }{
+		{"Authorization", "Bearer alice"},
+		{"Authorization", "Bearer bob"},
+		{"Cookie", "session=alice"},
+		{"Cookie", "session=bob"},
+	}
+	bodies := doConcurrently(t, client, len(credentials), func(i int) *http.Request {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set(credentials[i].header, credentials[i].value)
+		return req
+	})
+
+	if n := atomic.LoadInt32(&callCount); n != int32(len(credentials)) {
+		t.Errorf("expected every credential to reach the server, got %d calls", n)
+	}
+	for i, body := range bodies {
+		if want := "data for " + credentials[i].value; body != want {
+			t.Errorf("expected '%s', got '%s'", want, body)
+		}
+	}
+}
+
+func TestWithRequestCoalescing_NonIdempotentNotShared(t *testing.T) {
+	var callCount int32
+	server := newSlowServer(&callCount)
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRequestCoalescing())
+
+	doConcurrently(t, client, 3, func(int) *http.Request {
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("data"))
+		return req
+	})
+
+	if n := atomic.LoadInt32(&callCount); n != 3 {
+		t.Errorf("expected every POST to reach the server, got %d calls", n)
+	}
+}
+
+func TestWithRequestCoalescing_SequentialRequestsNotShared(t *testing.T) {
+	var callCount int32
+	server := newSlowServer(&callCount)
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRequestCoalescing())
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", n)
+	}
+}
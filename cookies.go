@@ -0,0 +1,233 @@
+package httpx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCookieJarKey = "cookies"
+
+// CookieJarOption configures a PersistentCookieJar.
+type CookieJarOption func(*PersistentCookieJar)
+
+// CookieJarKey sets the key the cookies are stored under (default:
+// "cookies"). Clients sharing a store need different keys to keep their
+// cookies apart.
+func CookieJarKey(key string) CookieJarOption {
+	return func(j *PersistentCookieJar) { j.key = key }
+}
+
+// CookieJarPublicSuffixList sets the public suffix list that keeps servers
+// from setting cookies for a whole registry domain such as "co.uk", e.g.
+// golang.org/x/net/publicsuffix.List.
+func CookieJarPublicSuffixList(list cookiejar.PublicSuffixList) CookieJarOption {
+	return func(j *PersistentCookieJar) { j.publicSuffixList = list }
+}
+
+// WithCookieJar sets the cookie jar of the client, e.g. a PersistentCookieJar.
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(c *client) { c.HttpClient.Jar = jar }
+}
+
+// PersistentCookieJar is an http.CookieJar following the semantics of
+// net/http/cookiejar that saves its cookies to a CacheStore after every
+// change, so sessions survive restarts. Session cookies without an expiry
+// are kept as well; expired cookies are dropped when saving and loading.
+type PersistentCookieJar struct {
+	store            CacheStore
+	key              string
+	publicSuffixList cookiejar.PublicSuffixList
+
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]storedCookie
+}
+
+// storedCookie is a cookie together with the URL that set it, so it can be
+// replayed into a new jar
+type storedCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Expires  time.Time     `json:"expires,omitzero"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"http_only,omitempty"`
+	SameSite http.SameSite `json:"same_site,omitempty"`
+}
+
+// NewPersistentCookieJar creates a jar and loads the cookies saved in store.
+func NewPersistentCookieJar(store CacheStore, opts ...CookieJarOption) (*PersistentCookieJar, error) {
+	j := &PersistentCookieJar{store: store, key: defaultCookieJarKey, cookies: make(map[string]storedCookie)}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: j.publicSuffixList})
+	if err != nil {
+		return nil, err
+	}
+	j.jar = jar
+
+	data, ok := store.Get(j.key)
+	if !ok {
+		return j, nil
+	}
+
+	var saved []storedCookie
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode saved cookies: %w", err)
+	}
+
+	now := time.Now()
+	for _, sc := range saved {
+		if !sc.Expires.IsZero() && !sc.Expires.After(now) {
+			continue
+		}
+		u, err := url.Parse(sc.URL)
+		if err != nil {
+			continue
+		}
+		j.set(u, sc.cookie(), now)
+	}
+	return j, nil
+}
+
+// SetCookies implements http.CookieJar.
+func (j *PersistentCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		j.set(u, cookie, now)
+	}
+	j.save(now)
+}
+
+// Cookies implements http.CookieJar.
+func (j *PersistentCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// set stores cookie in the jar and records it for saving, or forgets it when
+// the cookie deletes itself
+func (j *PersistentCookieJar) set(u *url.URL, cookie *http.Cookie, now time.Time) {
+	j.jar.SetCookies(u, []*http.Cookie{cookie})
+
+	key := cookieKey(u, cookie)
+	expires := cookie.Expires
+	switch {
+	case cookie.MaxAge < 0:
+		delete(j.cookies, key)
+		return
+	case cookie.MaxAge > 0:
+		expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !expires.IsZero() && !expires.After(now):
+		delete(j.cookies, key)
+		return
+	}
+
+	// The jar rejects some cookies, such as those for a foreign domain,
+	// which must not come back on the next load either
+	if !j.holds(u, cookie) {
+		return
+	}
+
+	j.cookies[key] = storedCookie{
+		URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   cookie.Domain,
+		Path:     cookie.Path,
+		Expires:  expires,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: cookie.SameSite,
+	}
+}
+
+// holds reports whether the jar sends cookie, set from u, to the URLs it is
+// scoped to
+func (j *PersistentCookieJar) holds(u *url.URL, cookie *http.Cookie) bool {
+	target := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: cookiePath(u, cookie)}
+	if cookie.Domain != "" {
+		target.Host = strings.TrimPrefix(cookie.Domain, ".")
+	}
+	if cookie.Secure {
+		target.Scheme = "https"
+	}
+
+	for _, c := range j.jar.Cookies(target) {
+		if c.Name == cookie.Name && c.Value == cookie.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the unexpired cookies to the store
+func (j *PersistentCookieJar) save(now time.Time) {
+	saved := make([]storedCookie, 0, len(j.cookies))
+	for key, sc := range j.cookies {
+		if !sc.Expires.IsZero() && !sc.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		saved = append(saved, sc)
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return
+	}
+	j.store.Set(j.key, data)
+}
+
+func (sc storedCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     sc.Name,
+		Value:    sc.Value,
+		Domain:   sc.Domain,
+		Path:     sc.Path,
+		Expires:  sc.Expires,
+		Secure:   sc.Secure,
+		HttpOnly: sc.HttpOnly,
+		SameSite: sc.SameSite,
+	}
+}
+
+// cookieKey identifies a cookie by domain, path and name like the jar does
+func cookieKey(u *url.URL, cookie *http.Cookie) string {
+	domain := strings.ToLower(u.Hostname())
+	if cookie.Domain != "" {
+		domain = "." + strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+	}
+
+	return domain + ";" + cookiePath(u, cookie) + ";" + cookie.Name
+}
+
+// cookiePath returns the path cookie is scoped to when set from u
+func cookiePath(u *url.URL, cookie *http.Cookie) string {
+	if cookie.Path == "" || cookie.Path[0] != '/' {
+		return defaultCookiePath(u.Path)
+	}
+	return cookie.Path
+}
+
+// defaultCookiePath returns the directory of the request path (RFC 6265 5.1.4)
+func defaultCookiePath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
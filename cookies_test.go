@@ -0,0 +1,181 @@
+package httpx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func cookieNames(cookies []*http.Cookie) map[string]string {
+	values := make(map[string]string, len(cookies))
+	for _, c := range cookies {
+		values[c.Name] = c.Value
+	}
+	return values
+}
+
+func TestPersistentCookieJar_SurvivesRestart(t *testing.T) {
+	var received []*http.Cookie
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "remember", Value: "yes", Path: "/", MaxAge: 3600})
+			return
+		}
+		received = r.Cookies()
+	}))
+	defer server.Close()
+
+	store, err := httpx.NewDiskCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	jar, err := httpx.NewPersistentCookieJar(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := getBody(t, newTestClient(httpx.WithCookieJar(jar)), server.URL+"/login"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A new jar on the same store stands in for a restarted process
+	restarted, err := httpx.NewPersistentCookieJar(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := getBody(t, newTestClient(httpx.WithCookieJar(restarted)), server.URL+"/api"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := cookieNames(received)
+	if got["session"] != "abc" || got["remember"] != "yes" {
+		t.Errorf("expected saved cookies to be sent after restart, got %v", got)
+	}
+}
+
+func TestPersistentCookieJar_Expiry(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(0)
+	u, _ := url.Parse("https://api.example.com/")
+
+	jar, _ := httpx.NewPersistentCookieJar(store)
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "short", Value: "1", Expires: time.Now().Add(50 * time.Millisecond)},
+		{Name: "long", Value: "2", Expires: time.Now().Add(time.Hour)},
+		{Name: "deleted", Value: "3"},
+	})
+	jar.SetCookies(u, []*http.Cookie{{Name: "deleted", MaxAge: -1}})
+
+	time.Sleep(100 * time.Millisecond)
+
+	restarted, err := httpx.NewPersistentCookieJar(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := cookieNames(restarted.Cookies(u))
+	if len(got) != 1 || got["long"] != "2" {
+		t.Errorf("expected only the unexpired cookie, got %v", got)
+	}
+}
+
+func TestPersistentCookieJar_Semantics(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(0)
+	origin, _ := url.Parse("https://example.com/account/login")
+
+	jar, _ := httpx.NewPersistentCookieJar(store)
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "domain", Value: "1", Domain: "example.com", Path: "/"},
+		{Name: "host", Value: "2", Path: "/"},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "scoped", Value: "4"},
+	})
+
+	restarted, _ := httpx.NewPersistentCookieJar(store)
+
+	testCases := []struct {
+		url  string
+		want map[string]string
+	}{
+		{"https://example.com/account/settings", map[string]string{"domain": "1", "host": "2", "secure": "3", "scoped": "4"}},
+		{"https://example.com/", map[string]string{"domain": "1", "host": "2", "secure": "3"}},
+		{"https://api.example.com/", map[string]string{"domain": "1"}},
+		{"http://example.com/", map[string]string{"domain": "1", "host": "2"}},
+		{"https://other.com/", map[string]string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			u, _ := url.Parse(tc.url)
+			got := cookieNames(restarted.Cookies(u))
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for name, value := range tc.want {
+				if got[name] != value {
+					t.Errorf("expected %s=%s, got %v", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistentCookieJar_OnlySavesAcceptedCookies(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(0)
+	origin, _ := url.Parse("https://api.example.com/")
+
+	jar, _ := httpx.NewPersistentCookieJar(store)
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "foreign", Value: "1", Domain: "evil.com", Path: "/"},
+		{Name: "sibling", Value: "2", Domain: "www.example.com", Path: "/"},
+		{Name: "kept", Value: "3", Path: "/"},
+	})
+
+	saved, _ := store.Get("cookies")
+	if strings.Contains(string(saved), "foreign") || strings.Contains(string(saved), "sibling") {
+		t.Errorf("expected rejected cookies not to be saved, got %s", saved)
+	}
+
+	restarted, _ := httpx.NewPersistentCookieJar(store)
+	for _, rawURL := range []string{"https://evil.com/", "https://www.example.com/"} {
+		u, _ := url.Parse(rawURL)
+		if got := restarted.Cookies(u); len(got) != 0 {
+			t.Errorf("expected no cookies for %s, got %v", rawURL, got)
+		}
+	}
+	if got := cookieNames(restarted.Cookies(origin)); len(got) != 1 || got["kept"] != "3" {
+		t.Errorf("expected accepted cookie to be restored, got %v", got)
+	}
+}
+
+func TestPersistentCookieJar_Isolation(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(0)
+	u, _ := url.Parse("https://api.example.com/")
+
+	first, _ := httpx.NewPersistentCookieJar(store, httpx.CookieJarKey("tenant-a"))
+	first.SetCookies(u, []*http.Cookie{{Name: "session", Value: "a"}})
+
+	second, _ := httpx.NewPersistentCookieJar(store, httpx.CookieJarKey("tenant-b"))
+	if cookies := second.Cookies(u); len(cookies) != 0 {
+		t.Errorf("expected no cookies for another key, got %v", cookies)
+	}
+
+	reloaded, _ := httpx.NewPersistentCookieJar(store, httpx.CookieJarKey("tenant-a"))
+	if got := cookieNames(reloaded.Cookies(u)); got["session"] != "a" {
+		t.Errorf("expected session cookie for the same key, got %v", got)
+	}
+}
+
+func TestPersistentCookieJar_CorruptStore(t *testing.T) {
+	store := httpx.NewMemoryCacheStore(0)
+	store.Set("cookies", []byte("not json"))
+
+	if _, err := httpx.NewPersistentCookieJar(store); err == nil {
+		t.Fatal("expected error for corrupt saved cookies")
+	}
+}
@@ -0,0 +1,366 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials authenticate requests to a host: a Token is sent as Bearer
+// auth, otherwise Username and Password as Basic auth. They never print
+// their secrets, neither with fmt nor slog.
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+func (c Credentials) String() string {
+	if c.Token != "" {
+		return "Credentials{Token: REDACTED}"
+	}
+	return fmt.Sprintf("Credentials{Username: %q, Password: REDACTED}", c.Username)
+}
+
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+func (c Credentials) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
+
+func (c *Credentials) scheme() string {
+	if c.Token != "" {
+		return "bearer"
+	}
+	return "basic"
+}
+
+// CredentialProvider looks up the credentials for a host name. It returns
+// nil without an error when it has none for host.
+type CredentialProvider interface {
+	Credentials(ctx context.Context, host string) (*Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function to a CredentialProvider.
+type CredentialProviderFunc func(ctx context.Context, host string) (*Credentials, error)
+
+func (f CredentialProviderFunc) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	return f(ctx, host)
+}
+
+// WithCredentials sets the Authorization header of requests that do not have
+// one from the first provider with credentials for the request host. Secrets
+// are never logged.
+func WithCredentials(providers ...CredentialProvider) ClientOption {
+	return func(c *client) {
+		t := &credentialsTransport{logger: c.Logger, providers: providers}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type credentialsTransport struct {
+	next      http.RoundTripper
+	logger    *slog.Logger
+	providers []CredentialProvider
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	host := req.URL.Hostname()
+	for _, provider := range t.providers {
+		creds, err := provider.Credentials(req.Context(), host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain credentials for %s: %w", host, err)
+		}
+		if creds == nil {
+			continue
+		}
+
+		t.logger.DebugContext(req.Context(), "applying credentials",
+			slog.String("host", host),
+			slog.String("scheme", creds.scheme()),
+		)
+
+		req = req.Clone(req.Context())
+		if creds.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+creds.Token)
+		} else {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+		break
+	}
+	return t.next.RoundTrip(req)
+}
+
+// EnvCredentials reads credentials from environment variables named after
+// prefix and the host, upper-cased with every other character than letters
+// and digits replaced by "_": for prefix "HTTPX" and host "api.example.com"
+// HTTPX_API_EXAMPLE_COM_TOKEN, or HTTPX_API_EXAMPLE_COM_USERNAME and
+// HTTPX_API_EXAMPLE_COM_PASSWORD.
+func EnvCredentials(prefix string) CredentialProvider {
+	return CredentialProviderFunc(func(_ context.Context, host string) (*Credentials, error) {
+		name := envName(prefix + "_" + host)
+		creds := &Credentials{
+			Username: os.Getenv(name + "_USERNAME"),
+			Password: os.Getenv(name + "_PASSWORD"),
+			Token:    os.Getenv(name + "_TOKEN"),
+		}
+		if creds.Token == "" && creds.Username == "" {
+			return nil, nil
+		}
+		return creds, nil
+	})
+}
+
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// FileCredentials reads credentials from a JSON file mapping host names to
+// objects with username and password or token, e.g. a mounted secret. The
+// file is read again when it changes.
+func FileCredentials(path string) CredentialProvider {
+	f := &fileCredentials{path: path}
+	return CredentialProviderFunc(func(_ context.Context, host string) (*Credentials, error) {
+		hosts, err := f.load()
+		if err != nil {
+			return nil, err
+		}
+		if creds, ok := hosts[host]; ok {
+			return &creds, nil
+		}
+		return nil, nil
+	})
+}
+
+// NetrcCredentials reads Basic auth credentials from a .netrc file, using the
+// default entry for hosts without a machine entry. An empty path uses $NETRC
+// or ~/.netrc. A missing file provides no credentials. The file is read again
+// when it changes.
+func NetrcCredentials(path string) CredentialProvider {
+	if path == "" {
+		path = defaultNetrcPath()
+	}
+	f := &fileCredentials{path: path, parse: parseNetrc}
+	return CredentialProviderFunc(func(_ context.Context, host string) (*Credentials, error) {
+		machines, err := f.load()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if creds, ok := machines[host]; ok {
+			return &creds, nil
+		}
+		if creds, ok := machines[""]; ok {
+			return &creds, nil
+		}
+		return nil, nil
+	})
+}
+
+func defaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// fileCredentials caches the parsed credentials of a file until its
+// modification time or size changes
+type fileCredentials struct {
+	path  string
+	parse func([]byte) (map[string]Credentials, error)
+
+	mu    sync.Mutex
+	state fileState
+	hosts map[string]Credentials
+}
+
+func (f *fileCredentials) load() (map[string]Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	state := fileState{modTime: info.ModTime(), size: info.Size()}
+	if f.hosts != nil && state == f.state {
+		return f.hosts, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := f.parse
+	if parse == nil {
+		parse = func(data []byte) (map[string]Credentials, error) {
+			var hosts map[string]Credentials
+			return hosts, json.Unmarshal(data, &hosts)
+		}
+	}
+	hosts, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+
+	f.hosts, f.state = hosts, state
+	return hosts, nil
+}
+
+// parseNetrc returns the credentials of every machine, the default entry
+// under the empty host name
+func parseNetrc(data []byte) (map[string]Credentials, error) {
+	machines := make(map[string]Credentials)
+
+	var host string
+	var creds *Credentials
+	flush := func() {
+		if creds != nil {
+			if _, ok := machines[host]; !ok {
+				machines[host] = *creds
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// A macro definition ends at the first empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				flush()
+				if i+1 >= len(fields) {
+					return nil, errors.New("machine without a name")
+				}
+				i++
+				host, creds = fields[i], &Credentials{}
+			case "default":
+				flush()
+				host, creds = "", &Credentials{}
+			case "login", "password", "account":
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("%s without a value", fields[i])
+				}
+				i++
+				if creds == nil {
+					continue
+				}
+				switch fields[i-1] {
+				case "login":
+					creds.Username = fields[i]
+				case "password":
+					creds.Password = fields[i]
+				}
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+	return machines, scanner.Err()
+}
+
+// ExecCredentials runs a credential helper for every lookup. The helper
+// receives the host name on stdin and prints a JSON object with username and
+// password or token, or nothing if it has no credentials for the host. Results
+// are cached per host for ttl, a zero ttl runs the helper every time.
+func ExecCredentials(ttl time.Duration, name string, args ...string) CredentialProvider {
+	e := &execCredentials{ttl: ttl, name: name, args: args, cache: make(map[string]execResult)}
+	return CredentialProviderFunc(e.credentials)
+}
+
+type execCredentials struct {
+	ttl  time.Duration
+	name string
+	args []string
+
+	mu    sync.Mutex
+	cache map[string]execResult
+}
+
+type execResult struct {
+	creds   *Credentials
+	expires time.Time
+}
+
+func (e *execCredentials) credentials(ctx context.Context, host string) (*Credentials, error) {
+	e.mu.Lock()
+	if result, ok := e.cache[host]; ok && time.Now().Before(result.expires) {
+		e.mu.Unlock()
+		return result.creds, nil
+	}
+	e.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, e.name, e.args...)
+	cmd.Stdin = strings.NewReader(host + "\n")
+
+	// Neither output nor stderr end up in errors, they may contain secrets
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s failed: %w", e.name, err)
+	}
+
+	var creds *Credentials
+	if len(bytes.TrimSpace(output)) > 0 {
+		creds = &Credentials{}
+		if err := json.Unmarshal(output, creds); err != nil {
+			return nil, fmt.Errorf("credential helper %s returned invalid output", e.name)
+		}
+		if creds.Token == "" && creds.Username == "" {
+			creds = nil
+		}
+	}
+
+	if e.ttl > 0 {
+		e.mu.Lock()
+		e.cache[host] = execResult{creds: creds, expires: time.Now().Add(e.ttl)}
+		e.mu.Unlock()
+	}
+	return creds, nil
+}
@@ -0,0 +1,249 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// newAuthEchoServer answers with the Authorization header it received
+func newAuthEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func basicAuth(user, password string) string {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(user, password)
+	return req.Header.Get("Authorization")
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	server := newAuthEchoServer(t)
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+
+	writeFileWithNewModTime(t, netrc, []byte(`
+machine other.example.com login other password other-secret
+macdef init
+	cd /pub
+	machine 127.0.0.1 login macro password macro
+
+machine 127.0.0.1
+	login alice
+	password s3cret
+default login anonymous password guest
+`))
+
+	client := newTestClient(httpx.WithCredentials(httpx.NetrcCredentials(netrc)))
+
+	if got, _ := getBody(t, client, server.URL); got != basicAuth("alice", "s3cret") {
+		t.Errorf("expected machine credentials, got %q", got)
+	}
+
+	t.Run("default entry", func(t *testing.T) {
+		localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		if got, _ := getBody(t, client, localhost); got != basicAuth("anonymous", "guest") {
+			t.Errorf("expected default credentials, got %q", got)
+		}
+	})
+
+	t.Run("reloads changed file", func(t *testing.T) {
+		writeFileWithNewModTime(t, netrc, []byte("machine 127.0.0.1 login bob password rotated\n"))
+		if got, _ := getBody(t, client, server.URL); got != basicAuth("bob", "rotated") {
+			t.Errorf("expected rotated credentials, got %q", got)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		client := newTestClient(httpx.WithCredentials(httpx.NetrcCredentials(filepath.Join(t.TempDir(), "missing"))))
+		got, err := getBody(t, client, server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != "" {
+			t.Errorf("expected no credentials, got %q", got)
+		}
+	})
+}
+
+func TestEnvCredentials(t *testing.T) {
+	server := newAuthEchoServer(t)
+
+	t.Run("token", func(t *testing.T) {
+		t.Setenv("HTTPX_127_0_0_1_TOKEN", "env-token")
+		client := newTestClient(httpx.WithCredentials(httpx.EnvCredentials("HTTPX")))
+		if got, _ := getBody(t, client, server.URL); got != "Bearer env-token" {
+			t.Errorf("expected bearer token, got %q", got)
+		}
+	})
+
+	t.Run("username and password", func(t *testing.T) {
+		t.Setenv("HTTPX_127_0_0_1_USERNAME", "env-user")
+		t.Setenv("HTTPX_127_0_0_1_PASSWORD", "env-password")
+		client := newTestClient(httpx.WithCredentials(httpx.EnvCredentials("HTTPX")))
+		if got, _ := getBody(t, client, server.URL); got != basicAuth("env-user", "env-password") {
+			t.Errorf("expected basic auth, got %q", got)
+		}
+	})
+}
+
+func TestFileCredentials(t *testing.T) {
+	server := newAuthEchoServer(t)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writeFileWithNewModTime(t, path, []byte(`{"127.0.0.1": {"token": "file-token"}}`))
+
+	client := newTestClient(httpx.WithCredentials(httpx.FileCredentials(path)))
+	if got, _ := getBody(t, client, server.URL); got != "Bearer file-token" {
+		t.Errorf("expected bearer token, got %q", got)
+	}
+
+	writeFileWithNewModTime(t, path, []byte(`{"127.0.0.1": {"username": "u", "password": "p"}}`))
+	if got, _ := getBody(t, client, server.URL); got != basicAuth("u", "p") {
+		t.Errorf("expected reloaded basic auth, got %q", got)
+	}
+
+	t.Run("missing file fails the request", func(t *testing.T) {
+		client := newTestClient(httpx.WithCredentials(httpx.FileCredentials(filepath.Join(t.TempDir(), "missing.json"))))
+		if _, err := getBody(t, client, server.URL); err == nil {
+			t.Fatal("expected error for missing credentials file")
+		}
+	})
+}
+
+func TestExecCredentials(t *testing.T) {
+	server := newAuthEchoServer(t)
+	calls := filepath.Join(t.TempDir(), "calls")
+	script := fmt.Sprintf(`read host; echo "$host" >> %q; echo "{\"username\": \"$host\", \"password\": \"helper-secret\"}"`, calls)
+
+	client := newTestClient(httpx.WithCredentials(httpx.ExecCredentials(0, "sh", "-c", script)))
+	if got, _ := getBody(t, client, server.URL); got != basicAuth("127.0.0.1", "helper-secret") {
+		t.Errorf("expected credentials from helper, got %q", got)
+	}
+
+	t.Run("caches results", func(t *testing.T) {
+		_ = os.Remove(calls)
+		client := newTestClient(httpx.WithCredentials(httpx.ExecCredentials(time.Minute, "sh", "-c", script)))
+		for range 3 {
+			if _, err := getBody(t, client, server.URL); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		data, _ := os.ReadFile(calls)
+		if n := strings.Count(string(data), "\n"); n != 1 {
+			t.Errorf("expected helper to run once, ran %d times", n)
+		}
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		client := newTestClient(httpx.WithCredentials(httpx.ExecCredentials(0, "sh", "-c", "cat > /dev/null")))
+		if got, _ := getBody(t, client, server.URL); got != "" {
+			t.Errorf("expected no credentials, got %q", got)
+		}
+	})
+
+	t.Run("failure does not leak output", func(t *testing.T) {
+		client := newTestClient(httpx.WithCredentials(httpx.ExecCredentials(0, "sh", "-c", `echo leaked-secret; echo leaked-secret >&2; exit 1`)))
+		_, err := getBody(t, client, server.URL)
+		if err == nil {
+			t.Fatal("expected error from failing helper")
+		}
+		if strings.Contains(err.Error(), "leaked-secret") {
+			t.Errorf("expected error without helper output, got %v", err)
+		}
+	})
+}
+
+func TestWithCredentials_Precedence(t *testing.T) {
+	server := newAuthEchoServer(t)
+
+	var secondCalls atomic.Int32
+	none := httpx.CredentialProviderFunc(func(context.Context, string) (*httpx.Credentials, error) {
+		return nil, nil
+	})
+	first := httpx.CredentialProviderFunc(func(context.Context, string) (*httpx.Credentials, error) {
+		return &httpx.Credentials{Token: "first"}, nil
+	})
+	second := httpx.CredentialProviderFunc(func(context.Context, string) (*httpx.Credentials, error) {
+		secondCalls.Add(1)
+		return &httpx.Credentials{Token: "second"}, nil
+	})
+
+	client := newTestClient(httpx.WithCredentials(none, first, second))
+	if got, _ := getBody(t, client, server.URL); got != "Bearer first" {
+		t.Errorf("expected first provider with credentials, got %q", got)
+	}
+	if secondCalls.Load() != 0 {
+		t.Error("expected later providers not to be asked")
+	}
+
+	t.Run("keeps explicit Authorization", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Authorization", "Bearer explicit")
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		if body.String() != "Bearer explicit" {
+			t.Errorf("expected explicit Authorization, got %q", body.String())
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		providerErr := errors.New("vault unavailable")
+		failing := httpx.CredentialProviderFunc(func(context.Context, string) (*httpx.Credentials, error) {
+			return nil, providerErr
+		})
+		client := newTestClient(httpx.WithCredentials(failing))
+		if _, err := getBody(t, client, server.URL); !errors.Is(err, providerErr) {
+			t.Errorf("expected provider error, got %v", err)
+		}
+	})
+}
+
+func TestCredentials_NeverLogged(t *testing.T) {
+	server := newAuthEchoServer(t)
+	creds := httpx.Credentials{Username: "alice", Password: "p4ssw0rd", Token: ""}
+	token := httpx.Credentials{Token: "t0ken"}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := httpx.New(logger, httpx.WithCredentials(httpx.CredentialProviderFunc(
+		func(context.Context, string) (*httpx.Credentials, error) { return &creds, nil },
+	)))
+
+	if _, err := getBody(t, client, server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Info("credentials", slog.Any("basic", creds), slog.Any("token", token))
+
+	output := logs.String() + fmt.Sprint(creds) + fmt.Sprintf("%+v %#v", token, token)
+	for _, secret := range []string{"p4ssw0rd", "t0ken", basicAuth("alice", "p4ssw0rd")} {
+		if strings.Contains(output, secret) {
+			t.Errorf("expected %q not to be printed, got:\n%s", secret, output)
+		}
+	}
+	if !strings.Contains(output, `msg="applying credentials" host=127.0.0.1 scheme=basic`) {
+		t.Errorf("expected credentials use to be logged, got:\n%s", output)
+	}
+}
@@ -0,0 +1,221 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+const defaultDigestAlgorithm = "sha-256"
+
+// digestAlgorithms are the supported RFC 9530 algorithms, strongest first
+var digestAlgorithms = []struct {
+	name    string
+	newHash func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+}
+
+// IntegrityError is returned when reading a response body whose digest does
+// not match its Content-Digest or Repr-Digest header.
+type IntegrityError struct {
+	Header    string
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s %s mismatch: expected %s, got %s", e.Header, e.Algorithm,
+		base64.StdEncoding.EncodeToString(e.Expected), base64.StdEncoding.EncodeToString(e.Actual))
+}
+
+// DigestOption configures the middleware created by WithContentDigest.
+type DigestOption func(*digestTransport)
+
+// DigestAlgorithm sets the algorithm used for request digests, "sha-256"
+// (default) or "sha-512".
+func DigestAlgorithm(alg string) DigestOption {
+	return func(t *digestTransport) { t.algorithm = alg }
+}
+
+// VerifyResponseDigest verifies Content-Digest or Repr-Digest on responses.
+// A mismatch surfaces as an *IntegrityError from the body Read that reaches EOF.
+// Responses to HEAD requests, 204, 206 and 304 responses and bodies decompressed
+// by the transport are not verified, since their body is not what the digests
+// cover.
+func VerifyResponseDigest() DigestOption {
+	return func(t *digestTransport) { t.verify = true }
+}
+
+// WithContentDigest adds a Content-Digest header (RFC 9530) to every request
+// with a body that does not have one yet.
+func WithContentDigest(opts ...DigestOption) ClientOption {
+	return func(c *client) {
+		t := &digestTransport{logger: c.Logger, redactor: c.redactor, algorithm: defaultDigestAlgorithm}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type digestTransport struct {
+	next      http.RoundTripper
+	logger    *slog.Logger
+	redactor  *logger.Redactor
+	algorithm string
+	verify    bool
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if newDigestHash(t.algorithm) == nil {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", t.algorithm)
+	}
+
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if hasBody && req.Header.Get("Content-Digest") == "" || t.verify {
+		req = req.Clone(req.Context())
+	}
+
+	if hasBody && req.Header.Get("Content-Digest") == "" {
+		body, err := bufferRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Digest", contentDigest(t.algorithm, body))
+	}
+	if t.verify && req.Header.Get("Want-Repr-Digest") == "" {
+		req.Header.Set("Want-Repr-Digest", t.algorithm+"=10")
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !t.verify || resp.Body == nil || !hasVerifiableDigest(req.Method, resp) {
+		return resp, err
+	}
+
+	for _, header := range []string{"Content-Digest", "Repr-Digest"} {
+		alg, expected, ok := parseDigestHeader(resp.Header.Get(header))
+		if !ok {
+			continue
+		}
+		resp.Body = &digestVerifyingReader{
+			ReadCloser: resp.Body,
+			hash:       newDigestHash(alg),
+			header:     header,
+			algorithm:  alg,
+			expected:   expected,
+			onMismatch: func(err error) {
+				t.logger.ErrorContext(req.Context(), "response digest mismatch",
+					slog.String("method", req.Method),
+					slog.String("url", t.redactor.URL(req.URL)),
+					slog.Any("error", err),
+				)
+			},
+		}
+		break
+	}
+	return resp, nil
+}
+
+// hasVerifiableDigest reports whether the digests of resp can be checked
+// against its body
+func hasVerifiableDigest(method string, resp *http.Response) bool {
+	switch {
+	case method == http.MethodHead,
+		resp.StatusCode == http.StatusNoContent,
+		resp.StatusCode == http.StatusNotModified,
+		resp.StatusCode == http.StatusPartialContent:
+		// The digests describe a representation that is not, or only
+		// partly, in the body
+		return false
+	case resp.Uncompressed:
+		// Both digests cover the encoded content, which is gone once the
+		// transport has transparently decompressed the body
+		return false
+	}
+	return true
+}
+
+// digestVerifyingReader hashes the body while it is read and fails at EOF if
+// the digest does not match
+type digestVerifyingReader struct {
+	io.ReadCloser
+	hash       hash.Hash
+	header     string
+	algorithm  string
+	expected   []byte
+	onMismatch func(error)
+	err        error
+}
+
+func (r *digestVerifyingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := r.hash.Sum(nil); !bytes.Equal(actual, r.expected) {
+			r.err = &IntegrityError{Header: r.header, Algorithm: r.algorithm, Expected: r.expected, Actual: actual}
+			r.onMismatch(r.err)
+			return n, r.err
+		}
+	}
+	return n, err
+}
+
+// contentDigest returns a Content-Digest header value for body (RFC 9530)
+func contentDigest(alg string, body []byte) string {
+	h := newDigestHash(alg)
+	h.Write(body)
+	return alg + "=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":"
+}
+
+func newDigestHash(alg string) hash.Hash {
+	for _, a := range digestAlgorithms {
+		if a.name == alg {
+			return a.newHash()
+		}
+	}
+	return nil
+}
+
+// parseDigestHeader returns the strongest supported digest of a
+// Content-Digest or Repr-Digest dictionary
+func parseDigestHeader(value string) (string, []byte, bool) {
+	digests := make(map[string][]byte)
+	for _, member := range strings.Split(value, ",") {
+		alg, encoded, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(strings.Trim(encoded, ":"))
+		if err != nil {
+			continue
+		}
+		digests[strings.ToLower(alg)] = digest
+	}
+
+	for _, a := range digestAlgorithms {
+		if digest, ok := digests[a.name]; ok {
+			return a.name, digest, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,275 @@
+package httpx_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func sha256Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func sha512Digest(body []byte) string {
+	sum := sha512.Sum512(body)
+	return "sha-512=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func TestWithContentDigest_Request(t *testing.T) {
+	body := []byte(`{"hello":"world"}`)
+
+	testCases := []struct {
+		name string
+		opts []httpx.DigestOption
+		want string
+	}{
+		{"default sha-256", nil, sha256Digest(body)},
+		{"sha-512", []httpx.DigestOption{httpx.DigestAlgorithm("sha-512")}, sha512Digest(body)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var digests []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				defer mu.Unlock()
+				if !bytes.Equal(received, body) {
+					t.Errorf("expected body %q, got %q", body, received)
+				}
+				digests = append(digests, r.Header.Get("Content-Digest"))
+				if len(digests) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+
+			client := newTestClient(
+				httpx.WithRetries(2),
+				httpx.WithRetryDelay(time.Millisecond),
+				httpx.WithContentDigest(tc.opts...),
+			)
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+			resp, err := client.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if len(digests) != 2 {
+				t.Fatalf("expected 2 attempts, got %d", len(digests))
+			}
+			for i, digest := range digests {
+				if digest != tc.want {
+					t.Errorf("attempt %d: expected Content-Digest %q, got %q", i+1, tc.want, digest)
+				}
+			}
+		})
+	}
+}
+
+func TestWithContentDigest_RequestHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithContentDigest())
+
+	t.Run("keeps existing header", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("body"))
+		req.Header.Set("Content-Digest", "sha-256=:precomputed:")
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if got.Get("Content-Digest") != "sha-256=:precomputed:" {
+			t.Errorf("expected existing Content-Digest to be kept, got %q", got.Get("Content-Digest"))
+		}
+	})
+
+	t.Run("skips requests without body", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if got.Get("Content-Digest") != "" {
+			t.Errorf("expected no Content-Digest, got %q", got.Get("Content-Digest"))
+		}
+	})
+}
+
+func TestWithContentDigest_UnsupportedAlgorithm(t *testing.T) {
+	client := newTestClient(httpx.WithContentDigest(httpx.DigestAlgorithm("md5")))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.invalid", strings.NewReader("body"))
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Fatal("expected error for unsupported algorithm")
+	}
+}
+
+func TestWithContentDigest_VerifyResponse(t *testing.T) {
+	body := []byte("response body")
+
+	testCases := []struct {
+		name    string
+		header  string
+		value   string
+		wantErr bool
+	}{
+		{"matching sha-256", "Content-Digest", sha256Digest(body), false},
+		{"matching sha-512", "Content-Digest", sha512Digest(body), false},
+		{"prefers strongest", "Content-Digest", sha256Digest([]byte("other")) + ", " + sha512Digest(body), false},
+		{"matching repr-digest", "Repr-Digest", sha256Digest(body), false},
+		{"mismatch", "Content-Digest", sha256Digest([]byte("tampered")), true},
+		{"unsupported algorithm", "Content-Digest", "md5=:AAAA:", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Want-Repr-Digest") == "" {
+					t.Error("expected Want-Repr-Digest header")
+				}
+				w.Header().Set(tc.header, tc.value)
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			client := newTestClient(httpx.WithContentDigest(httpx.VerifyResponseDigest()))
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := client.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			received, err := io.ReadAll(resp.Body)
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !bytes.Equal(received, body) {
+					t.Errorf("expected body %q, got %q", body, received)
+				}
+				return
+			}
+
+			var integrityErr *httpx.IntegrityError
+			if !errors.As(err, &integrityErr) {
+				t.Fatalf("expected IntegrityError, got %v", err)
+			}
+			if integrityErr.Header != "Content-Digest" || integrityErr.Algorithm != "sha-256" {
+				t.Errorf("unexpected error details: %+v", integrityErr)
+			}
+		})
+	}
+}
+
+func TestWithContentDigest_VerifyDecompressedResponse(t *testing.T) {
+	body := []byte(strings.Repeat("compressible ", 100))
+
+	var encoded bytes.Buffer
+	gz := gzip.NewWriter(&encoded)
+	_, _ = gz.Write(body)
+	_ = gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Both digests cover the gzip encoded content (RFC 9530)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Digest", sha256Digest(encoded.Bytes()))
+		w.Header().Set("Repr-Digest", sha256Digest(encoded.Bytes()))
+		_, _ = w.Write(encoded.Bytes())
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithContentDigest(httpx.VerifyResponseDigest()))
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	received, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(received, body) {
+		t.Error("expected decompressed body")
+	}
+}
+
+func TestWithContentDigest_SkipsResponsesWithoutFullBody(t *testing.T) {
+	body := []byte("full representation")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Digest", sha256Digest(body))
+		w.Header().Set("Repr-Digest", sha256Digest(body))
+		switch r.URL.Path {
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/partial":
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-3/%d", len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(body[:4])
+		default:
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithContentDigest(httpx.VerifyResponseDigest()))
+
+	testCases := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodHead, "/"},
+		{http.MethodGet, "/no-content"},
+		{http.MethodGet, "/not-modified"},
+		{http.MethodGet, "/partial"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, server.URL+tc.path, nil)
+			resp, err := client.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if _, err := io.ReadAll(resp.Body); err != nil {
+				t.Errorf("expected no integrity error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// WithDigestAuth answers HTTP Digest challenges (RFC 7616) with username and
+// password. When a server answers 401 with a Digest challenge the request is
+// replayed once, body included, with an Authorization header computed for the
+// strongest supported algorithm: SHA-256, SHA-256-sess, MD5 or MD5-sess. The
+// challenge is then cached per host and reused for subsequent requests with an
+// increasing nonce count, so they are authenticated without a round trip until
+// the server issues a new nonce. Challenges from another origin reached through
+// a redirect are not answered.
+func WithDigestAuth(username, password string) ClientOption {
+	return func(c *client) {
+		t := &digestAuthTransport{
+			logger:     c.Logger,
+			redactor:   c.redactor,
+			username:   username,
+			password:   password,
+			challenges: make(map[string]*digestChallenge),
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type digestAuthTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	username string
+	password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+func (t *digestAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Header.Get("Authorization") != "" || isCrossOriginRedirect(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	// The body is buffered so it can be sent again with the answer to a challenge
+	authReq := req.Clone(ctx)
+	body, err := bufferRequestBody(authReq)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := t.challenge(req.URL.Host)
+	if cached != nil {
+		authorization, err := cached.authorize(t.username, t.password, authReq.Method, authReq.URL.RequestURI(), body)
+		if err != nil {
+			return nil, err
+		}
+		authReq.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := t.next.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := selectDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	// A fresh challenge for the nonce we already answered means the
+	// credentials were rejected, unless the server only found it stale
+	if cached != nil && cached.nonce == challenge.nonce && !challenge.stale {
+		t.logger.WarnContext(ctx, "digest credentials rejected",
+			slog.String("method", req.Method),
+			slog.String("url", t.redactor.URL(req.URL)),
+			slog.String("realm", challenge.realm),
+		)
+		t.forget(req.URL.Host, cached)
+		return resp, nil
+	}
+
+	t.logger.InfoContext(ctx, "answering digest challenge",
+		slog.String("method", req.Method),
+		slog.String("url", t.redactor.URL(req.URL)),
+		slog.String("realm", challenge.realm),
+		slog.String("algorithm", challenge.algorithm),
+		slog.Bool("stale", challenge.stale),
+	)
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	t.mu.Lock()
+	t.challenges[req.URL.Host] = challenge
+	t.mu.Unlock()
+
+	replayReq := req.Clone(ctx)
+	if body != nil {
+		replayReq.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	authorization, err := challenge.authorize(t.username, t.password, replayReq.Method, replayReq.URL.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+	replayReq.Header.Set("Authorization", authorization)
+
+	return t.next.RoundTrip(replayReq)
+}
+
+func (t *digestAuthTransport) challenge(host string) *digestChallenge {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.challenges[host]
+}
+
+// forget drops the cached challenge of host unless another request already
+// replaced it
+func (t *digestAuthTransport) forget(host string, challenge *digestChallenge) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.challenges[host] == challenge {
+		delete(t.challenges, host)
+	}
+}
+
+// digestAuthAlgorithms lists the supported algorithms, strongest first
+var digestAuthAlgorithms = []string{"SHA-256", "SHA-256-sess", "MD5", "MD5-sess"}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	stale     bool
+
+	mu         sync.Mutex
+	nonceCount uint32
+}
+
+// selectDigestChallenge returns the Digest challenge with the strongest
+// supported algorithm, nil if there is none
+func selectDigestChallenge(headers []string) *digestChallenge {
+	var best *digestChallenge
+	bestRank := len(digestAuthAlgorithms)
+
+	for _, header := range headers {
+		for _, params := range parseDigestChallenges(header) {
+			algorithm := params["algorithm"]
+			if algorithm == "" {
+				algorithm = "MD5"
+			}
+			rank := len(digestAuthAlgorithms)
+			for i, supported := range digestAuthAlgorithms {
+				if strings.EqualFold(algorithm, supported) {
+					algorithm, rank = supported, i
+				}
+			}
+			if rank >= bestRank || params["nonce"] == "" {
+				continue
+			}
+
+			qop := ""
+			for option := range strings.SplitSeq(params["qop"], ",") {
+				switch strings.ToLower(strings.TrimSpace(option)) {
+				case "auth":
+					qop = "auth"
+				case "auth-int":
+					if qop == "" {
+						qop = "auth-int"
+					}
+				}
+			}
+			if params["qop"] != "" && qop == "" {
+				continue
+			}
+
+			best, bestRank = &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: algorithm,
+				qop:       qop,
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+				stale:     strings.EqualFold(params["stale"], "true"),
+			}, rank
+		}
+	}
+	return best
+}
+
+// parseDigestChallenges returns the parameters of every Digest challenge in a
+// WWW-Authenticate header, which may also hold challenges of other schemes
+func parseDigestChallenges(header string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return challenges
+		}
+
+		end := strings.IndexAny(s, " \t,=")
+		if end < 0 {
+			end = len(s)
+		}
+		token := s[:end]
+		s = strings.TrimLeft(s[end:], " \t")
+
+		if !strings.HasPrefix(s, "=") {
+			// A token without a value starts a new challenge
+			current = nil
+			if strings.EqualFold(token, "Digest") {
+				current = make(map[string]string)
+				challenges = append(challenges, current)
+			}
+			continue
+		}
+
+		var value string
+		value, s = parseAuthParamValue(strings.TrimLeft(s[1:], " \t"))
+		if current != nil {
+			current[strings.ToLower(token)] = value
+		}
+	}
+}
+
+// parseAuthParamValue parses a token or quoted string at the start of s and
+// returns it with the rest of s
+func parseAuthParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, " \t,")
+		if end < 0 {
+			return s, ""
+		}
+		return s[:end], s[end:]
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return value.String(), ""
+}
+
+// authorize returns the Authorization header answering the challenge,
+// counting the nonce use
+func (c *digestChallenge) authorize(username, password, method, uri string, body []byte) (string, error) {
+	c.mu.Lock()
+	c.nonceCount++
+	nc := fmt.Sprintf("%08x", c.nonceCount)
+	c.mu.Unlock()
+
+	cnonce := make([]byte, 16)
+	if _, err := rand.Read(cnonce); err != nil {
+		return "", fmt.Errorf("failed to generate digest cnonce: %w", err)
+	}
+	return c.authorization(username, password, method, uri, body, nc, hex.EncodeToString(cnonce)), nil
+}
+
+func (c *digestChallenge) authorization(username, password, method, uri string, body []byte, nc, cnonce string) string {
+	newHash := md5.New
+	if strings.HasPrefix(c.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(parts ...string) string {
+		return digestHash(newHash, strings.Join(parts, ":"))
+	}
+
+	ha1 := h(username, c.realm, password)
+	if strings.HasSuffix(c.algorithm, "-sess") {
+		ha1 = h(ha1, c.nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+	if c.qop == "auth-int" {
+		ha2 = h(method, uri, h(string(body)))
+	}
+
+	var response string
+	if c.qop == "" {
+		// RFC 2069 compatibility, without nonce count or client nonce
+		response = h(ha1, c.nonce, ha2)
+	} else {
+		response = h(ha1, c.nonce, nc, cnonce, c.qop, ha2)
+	}
+
+	if c.userhash {
+		username = h(username, c.realm)
+	}
+
+	params := []string{
+		"username=" + quoteAuthParam(username),
+		"realm=" + quoteAuthParam(c.realm),
+		"uri=" + quoteAuthParam(uri),
+		"algorithm=" + c.algorithm,
+		"nonce=" + quoteAuthParam(c.nonce),
+	}
+	if c.qop != "" {
+		params = append(params, "nc="+nc, "cnonce="+quoteAuthParam(cnonce), "qop="+c.qop)
+	}
+	params = append(params, "response="+quoteAuthParam(response))
+	if c.opaque != "" {
+		params = append(params, "opaque="+quoteAuthParam(c.opaque))
+	}
+	if c.userhash {
+		params = append(params, "userhash=true")
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func digestHash(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func quoteAuthParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,256 @@
+package httpx_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+var authParamPattern = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+func parseDigestAuthorization(header string) map[string]string {
+	params := make(map[string]string)
+	for _, match := range authParamPattern.FindAllStringSubmatch(strings.TrimPrefix(header, "Digest "), -1) {
+		params[match[1]] = match[2] + match[3]
+	}
+	return params
+}
+
+// digestServer is a server protected by Digest auth that verifies responses
+// independently of the client
+type digestServer struct {
+	*httptest.Server
+
+	algorithm string
+	username  string
+	password  string
+
+	mu        sync.Mutex
+	nonce     string
+	stale     bool
+	requests  int
+	bodies    []string
+	nonceUses []string
+}
+
+func newDigestServer(t *testing.T, algorithm, username, password string) *digestServer {
+	t.Helper()
+
+	s := &digestServer{algorithm: algorithm, username: username, password: password, nonce: "nonce-1"}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *digestServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	params := parseDigestAuthorization(r.Header.Get("Authorization"))
+	if params["nonce"] != "" && params["nonce"] != s.nonce {
+		s.stale = true
+	}
+	if params["nonce"] != s.nonce || params["response"] != s.expectedResponse(r.Method, params) {
+		w.Header().Add("WWW-Authenticate", `Basic realm="legacy"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(
+			`Digest realm="appliance", qop="auth", algorithm=%s, nonce="%s", opaque="opaque-value", stale=%t`,
+			s.algorithm, s.nonce, s.stale,
+		))
+		s.stale = false
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.bodies = append(s.bodies, string(body))
+	s.nonceUses = append(s.nonceUses, params["nc"])
+	_, _ = io.WriteString(w, "authenticated")
+}
+
+func (s *digestServer) expectedResponse(method string, params map[string]string) string {
+	newHash := md5.New
+	if strings.HasPrefix(s.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(parts ...string) string {
+		hash := newHash()
+		hash.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	if params["username"] != s.username || params["opaque"] != "opaque-value" || params["algorithm"] != s.algorithm {
+		return "invalid"
+	}
+	ha1 := h(s.username, "appliance", s.password)
+	if strings.HasSuffix(s.algorithm, "-sess") {
+		ha1 = h(ha1, s.nonce, params["cnonce"])
+	}
+	return h(ha1, s.nonce, params["nc"], params["cnonce"], params["qop"], h(method, params["uri"]))
+}
+
+func (s *digestServer) rotateNonce(nonce string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonce = nonce
+}
+
+func (s *digestServer) stats() (requests int, bodies, nonceUses []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, append([]string(nil), s.bodies...), append([]string(nil), s.nonceUses...)
+}
+
+func postBody(t *testing.T, client httpx.Client, url, body string) (int, error) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func TestWithDigestAuth_Algorithms(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "MD5-sess", "SHA-256", "SHA-256-sess"} {
+		t.Run(algorithm, func(t *testing.T) {
+			server := newDigestServer(t, algorithm, "admin", "secret")
+			client := newTestClient(httpx.WithDigestAuth("admin", "secret"))
+
+			status, err := postBody(t, client, server.URL+"/config?section=network", `{"dhcp":true}`)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != http.StatusOK {
+				t.Fatalf("expected 200, got %d", status)
+			}
+
+			requests, bodies, _ := server.stats()
+			if requests != 2 {
+				t.Errorf("expected challenge and authenticated attempt, got %d requests", requests)
+			}
+			if len(bodies) != 1 || bodies[0] != `{"dhcp":true}` {
+				t.Errorf("expected body to be replayed, got %q", bodies)
+			}
+		})
+	}
+}
+
+func TestWithDigestAuth_CachesChallenge(t *testing.T) {
+	server := newDigestServer(t, "SHA-256", "admin", "secret")
+	client := newTestClient(httpx.WithDigestAuth("admin", "secret"))
+
+	for i := range 3 {
+		if status, err := postBody(t, client, server.URL, fmt.Sprintf("body-%d", i)); err != nil || status != http.StatusOK {
+			t.Fatalf("expected 200, got %d (%v)", status, err)
+		}
+	}
+
+	requests, bodies, nonceUses := server.stats()
+	if requests != 4 {
+		t.Errorf("expected a single challenge round trip, got %d requests", requests)
+	}
+	if strings.Join(bodies, ",") != "body-0,body-1,body-2" {
+		t.Errorf("expected every body to arrive, got %q", bodies)
+	}
+	if strings.Join(nonceUses, ",") != "00000001,00000002,00000003" {
+		t.Errorf("expected increasing nonce counts, got %v", nonceUses)
+	}
+}
+
+func TestWithDigestAuth_StaleNonce(t *testing.T) {
+	server := newDigestServer(t, "MD5", "admin", "secret")
+	client := newTestClient(httpx.WithDigestAuth("admin", "secret"))
+
+	if status, err := postBody(t, client, server.URL, "first"); err != nil || status != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%v)", status, err)
+	}
+
+	server.rotateNonce("nonce-2")
+	if status, err := postBody(t, client, server.URL, "second"); err != nil || status != http.StatusOK {
+		t.Fatalf("expected 200 after nonce rotation, got %d (%v)", status, err)
+	}
+
+	_, bodies, nonceUses := server.stats()
+	if strings.Join(bodies, ",") != "first,second" {
+		t.Errorf("expected both bodies to arrive, got %q", bodies)
+	}
+	if strings.Join(nonceUses, ",") != "00000001,00000001" {
+		t.Errorf("expected nonce count to restart for the new nonce, got %v", nonceUses)
+	}
+}
+
+func TestWithDigestAuth_WrongPassword(t *testing.T) {
+	server := newDigestServer(t, "SHA-256", "admin", "secret")
+	client := newTestClient(httpx.WithDigestAuth("admin", "wrong"))
+
+	status, err := postBody(t, client, server.URL, "body")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", status)
+	}
+	if requests, _, _ := server.stats(); requests != 2 {
+		t.Errorf("expected a single replay, got %d requests", requests)
+	}
+}
+
+func TestWithDigestAuth_PrefersStrongestAlgorithm(t *testing.T) {
+	var algorithms []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			algorithms = append(algorithms, parseDigestAuthorization(auth)["algorithm"])
+			return
+		}
+		w.Header().Set("WWW-Authenticate",
+			`Digest realm="r", qop="auth", algorithm=MD5, nonce="n", Digest realm="r", qop="auth", algorithm=SHA-256, nonce="n"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := getBody(t, newTestClient(httpx.WithDigestAuth("u", "p")), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(algorithms) != 1 || algorithms[0] != "SHA-256" {
+		t.Errorf("expected SHA-256 to be chosen, got %v", algorithms)
+	}
+}
+
+func TestWithDigestAuth_NotAnsweredForOtherOrigin(t *testing.T) {
+	var authorizations []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("WWW-Authenticate", `Digest realm="r", qop="auth", algorithm=SHA-256, nonce="n"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithDigestAuth("admin", "secret"))
+	if _, err := getBody(t, client, server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(authorizations) != 1 || authorizations[0] != "" {
+		t.Errorf("expected challenge of other origin not to be answered, got %q", authorizations)
+	}
+}
@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// FallbackFunc produces a substitute result for a request that failed. A
+// fallback returning neither a response nor an error does not handle the
+// failure, which is then returned as is.
+type FallbackFunc func(ctx context.Context, req *http.Request, err error) (*http.Response, error)
+
+// StatusError is passed to a FallbackFunc when the last attempt still returned
+// a retryable status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d", e.StatusCode)
+}
+
+type fallbackContextKey struct{}
+
+// ContextWithFallback registers fn as the fallback for requests sent with the
+// returned context. It takes precedence over fallbacks configured on the client.
+func ContextWithFallback(ctx context.Context, fn FallbackFunc) context.Context {
+	return context.WithValue(ctx, fallbackContextKey{}, fn)
+}
+
+// WithFallback registers fn as the fallback for every request made by the
+// client. Do invokes it when retries are exhausted, the context deadline
+// leaves no time for another attempt, or a non-retryable error occurs.
+func WithFallback(fn FallbackFunc) ClientOption {
+	return func(c *client) { c.fallback = fn }
+}
+
+// WithHostFallback registers fn as the fallback for requests to host, which is
+// matched against both the host name and host:port of the request URL. It
+// takes precedence over WithFallback.
+func WithHostFallback(host string, fn FallbackFunc) ClientOption {
+	return func(c *client) {
+		if c.hostFallbacks == nil {
+			c.hostFallbacks = make(map[string]FallbackFunc)
+		}
+		c.hostFallbacks[host] = fn
+	}
+}
+
+// fallbackFor returns the most specific fallback registered for req
+func (c *client) fallbackFor(ctx context.Context, req *http.Request) FallbackFunc {
+	if fn, ok := ctx.Value(fallbackContextKey{}).(FallbackFunc); ok {
+		return fn
+	}
+	if fn, ok := c.hostFallbacks[req.URL.Host]; ok {
+		return fn
+	}
+	if fn, ok := c.hostFallbacks[req.URL.Hostname()]; ok {
+		return fn
+	}
+	return c.fallback
+}
+
+// applyFallback replaces a failed result with the result of fn, unless fn
+// returns neither a response nor an error
+func (c *client) applyFallback(ctx context.Context, req *http.Request, fn FallbackFunc, resp *http.Response, err error) (*http.Response, error) {
+	fallbackErr := err
+	if err == nil {
+		if !c.shouldRetry(resp.StatusCode) {
+			return resp, nil
+		}
+		fallbackErr = &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	c.Logger.WarnContext(ctx, "invoking fallback for failed request",
+		slog.String("method", req.Method),
+		slog.String("url", c.redactor.URL(req.URL)),
+		slog.Any("error", c.redactor.Error(fallbackErr)),
+	)
+
+	fallbackResp, fallbackErr := fn(ctx, req, fallbackErr)
+	if fallbackResp == nil && fallbackErr == nil {
+		c.Logger.WarnContext(ctx, "fallback did not handle failed request",
+			slog.String("method", req.Method),
+			slog.String("url", c.redactor.URL(req.URL)),
+		)
+		return resp, err
+	}
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	return fallbackResp, fallbackErr
+}
@@ -0,0 +1,220 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func fallbackResponse(body string) httpx.FallbackFunc {
+	return func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+}
+
+func TestWithFallback_RetriesExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var fallbackErr error
+	client := newTestClient(
+		httpx.WithRetries(2),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithFallback(func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+			fallbackErr = err
+			return fallbackResponse("default")(ctx, req, err)
+		}),
+	)
+
+	_, body := doGet(t, client, server.URL, nil)
+	if body != "default" {
+		t.Errorf("expected fallback body 'default', got '%s'", body)
+	}
+
+	var statusErr *httpx.StatusError
+	if !errors.As(fallbackErr, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected StatusError with 503, got %v", fallbackErr)
+	}
+}
+
+func TestWithFallback_NetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var called bool
+	client := newTestClient(httpx.WithFallback(func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+		called = true
+		if err == nil {
+			t.Error("expected fallback to receive the network error")
+		}
+		return nil, err
+	}))
+
+	req, _ := http.NewRequest("GET", url, nil)
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Error("expected error returned by fallback")
+	}
+	if !called {
+		t.Error("expected fallback to be called")
+	}
+}
+
+func TestWithFallback_NilResultKeepsFailure(t *testing.T) {
+	notHandled := func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+		return nil, nil
+	}
+
+	t.Run("status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("unavailable"))
+		}))
+		defer server.Close()
+
+		client := newTestClient(httpx.WithRetryDelay(time.Millisecond), httpx.WithFallback(notHandled))
+
+		resp, body := doGet(t, client, server.URL, nil)
+		if resp.StatusCode != http.StatusServiceUnavailable || body != "unavailable" {
+			t.Errorf("expected the original 503 response, got %d '%s'", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		url := server.URL
+		server.Close()
+
+		client := newTestClient(httpx.WithRetryDelay(time.Millisecond), httpx.WithFallback(notHandled))
+
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err == nil || resp != nil {
+			t.Errorf("expected the original error, got %v, %v", resp, err)
+		}
+	})
+}
+
+func TestWithFallback_NotCalledOnSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithFallback(fallbackResponse("default")))
+
+	if _, body := doGet(t, client, server.URL, nil); body != "real" {
+		t.Errorf("expected real body, got '%s'", body)
+	}
+}
+
+func TestWithFallback_Precedence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := newTestClient(
+		httpx.WithFallback(fallbackResponse("client")),
+		httpx.WithHostFallback(host, fallbackResponse("host")),
+	)
+
+	if _, body := doGet(t, client, server.URL, nil); body != "host" {
+		t.Errorf("expected host fallback, got '%s'", body)
+	}
+
+	ctx := httpx.ContextWithFallback(context.Background(), fallbackResponse("request"))
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "request" {
+		t.Errorf("expected request fallback, got '%s'", body)
+	}
+}
+
+func TestWithFallback_NoTimeForRetry(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var fallbackErr error
+	client := newTestClient(
+		httpx.WithRetries(3),
+		httpx.WithRetryDelay(time.Second),
+		httpx.WithFallback(func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+			fallbackErr = err
+			return fallbackResponse("default")(ctx, req, err)
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if duration := time.Since(start); duration > 150*time.Millisecond {
+		t.Errorf("expected Do to give up without waiting for the deadline, took %v", duration)
+	}
+	if n := atomic.LoadInt32(&callCount); n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+	if !errors.Is(fallbackErr, httpx.ErrNoTimeForRetry) || !errors.Is(fallbackErr, context.DeadlineExceeded) {
+		t.Errorf("expected ErrNoTimeForRetry, got %v", fallbackErr)
+	}
+}
+
+func TestWithFallback_NonRetryableError(t *testing.T) {
+	// The default transport does not trust the test server certificate
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var called bool
+	client := newTestClient(
+		httpx.WithRetries(3),
+		httpx.WithRetryDelay(time.Second),
+		httpx.WithFallback(func(ctx context.Context, req *http.Request, err error) (*http.Response, error) {
+			called = true
+			return fallbackResponse("default")(ctx, req, err)
+		}),
+	)
+
+	start := time.Now()
+	if _, body := doGet(t, client, server.URL, nil); body != "default" {
+		t.Errorf("expected fallback body, got '%s'", body)
+	}
+	if duration := time.Since(start); duration > 500*time.Millisecond {
+		t.Errorf("expected certificate errors not to be retried, took %v", duration)
+	}
+	if !called {
+		t.Error("expected fallback to be called")
+	}
+}
@@ -3,6 +3,9 @@ package httpx
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,6 +15,11 @@ import (
 	"github.com/extosoft-devsecops/httpx/logger"
 )
 
+// ErrNoTimeForRetry is returned when the context deadline would expire before
+// the next retry attempt could be sent. It is always accompanied by
+// context.DeadlineExceeded.
+var ErrNoTimeForRetry = errors.New("context deadline leaves no time for another attempt")
+
 const (
 	defaultRetries      = 1
 	defaultHTTPTimeout  = 10 * time.Second
@@ -29,10 +37,50 @@ type client struct {
 	Retries      int
 	RetryDelay   time.Duration
 	MaxRetryWait time.Duration
+
+	// transport sends the requests at the end of the middleware chain when an
+	// option needs its own, see baseTransport
+	transport        *http.Transport
+	destinationGuard *destinationGuard
+	redirects        *redirectPolicy
+	redactor         *logger.Redactor
+	loggingOpts      []logger.LoggingOption
+	middlewares      []Middleware
+	staleFallback    *staleFallback
+	fallback         FallbackFunc
+	hostFallbacks    map[string]FallbackFunc
 }
 
 type ClientOption func(*client)
 
+// Middleware wraps the transport used for every attempt made by Do, so each
+// retry passes through it again.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// WithMiddleware appends middlewares to the transport chain. The first
+// middleware is the outermost one.
+func WithMiddleware(mw ...Middleware) ClientOption {
+	return func(c *client) { c.middlewares = append(c.middlewares, mw...) }
+}
+
+// WithLogRedaction redacts more headers and query parameters in every log
+// line of the client, on top of the defaults of logger.NewRedactor. URL
+// userinfo is always redacted.
+func WithLogRedaction(opts ...logger.RedactOption) ClientOption {
+	return func(c *client) {
+		for _, opt := range opts {
+			opt(c.redactor)
+		}
+	}
+}
+
+// WithLoggingOptions configures the logging transport of the client, for
+// example to log headers with logger.WithHeaderLogging. Bodies are not logged
+// unless enabled with logger.WithBodyLogging.
+func WithLoggingOptions(opts ...logger.LoggingOption) ClientOption {
+	return func(c *client) { c.loggingOpts = append(c.loggingOpts, opts...) }
+}
+
 func WithRetries(n int) ClientOption {
 	return func(c *client) { c.Retries = n }
 }
@@ -50,31 +98,87 @@ func WithMaxRetryWait(d time.Duration) ClientOption {
 }
 
 func New(log *slog.Logger, opts ...ClientOption) Client {
-	transport := logger.NewLoggingRoundTripper(
-		log,
-		http.DefaultTransport,
-		logger.WithBodyLogging(false),
-	)
-
 	c := &client{
 		HttpClient: &http.Client{
-			Transport: transport,
-			Timeout:   defaultHTTPTimeout,
+			Timeout: defaultHTTPTimeout,
 		},
 		Logger:       log,
 		Retries:      defaultRetries,
 		RetryDelay:   defaultRetryDelay,
 		MaxRetryWait: defaultMaxRetryWait,
+		redirects:    defaultRedirectPolicy(),
+		redactor:     logger.NewRedactor(),
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	base := http.DefaultTransport
+	if c.transport != nil {
+		// Proxies may be configured before or after the guard
+		if c.destinationGuard != nil {
+			c.transport.Proxy = c.destinationGuard.proxy(c.transport.Proxy)
+		}
+		base = c.transport
+	}
+
+	loggingOpts := append([]logger.LoggingOption{
+		logger.WithBodyLogging(false),
+		logger.WithRedactor(c.redactor),
+	}, c.loggingOpts...)
+	var transport http.RoundTripper = &redirectAuthTransport{
+		next: logger.NewLoggingRoundTripper(log, base, loggingOpts...),
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		transport = c.middlewares[i](transport)
+	}
+	c.HttpClient.Transport = transport
+
+	c.redirects.logger = log
+	c.redirects.redactor = c.redactor
+	c.HttpClient.CheckRedirect = c.redirects.checkRedirect
+
 	return c
 }
 
+// baseTransport returns the transport options configure, creating it on first
+// use as a copy of http.DefaultTransport so their settings do not leak into
+// other clients. Clients without such options share http.DefaultTransport and
+// its connection pool.
+func (c *client) baseTransport() *http.Transport {
+	if c.transport == nil {
+		c.transport = newBaseTransport()
+	}
+	return c.transport
+}
+
+func newBaseTransport() *http.Transport {
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return &http.Transport{Proxy: http.ProxyFromEnvironment, ForceAttemptHTTP2: true}
+}
+
 func (c *client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	// Use context from request if not provided
+	if ctx == nil {
+		ctx = req.Context()
+	}
+
+	resp, err := c.doWithRetries(ctx, req)
+
+	if c.staleFallback != nil {
+		resp, err = c.applyStaleFallback(ctx, req, resp, err)
+	}
+	if fallback := c.fallbackFor(ctx, req); fallback != nil {
+		resp, err = c.applyFallback(ctx, req, fallback, resp, err)
+	}
+	return resp, err
+}
+
+// doWithRetries sends req, retrying on network errors and retryable status codes
+func (c *client) doWithRetries(ctx context.Context, req *http.Request) (*http.Response, error) {
 	var bodyBytes []byte
 	var lastErr error
 
@@ -87,16 +191,19 @@ func (c *client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 		_ = req.Body.Close()
 	}
 
-	// Use context from request if not provided
-	if ctx == nil {
-		ctx = req.Context()
-	}
 	req = req.WithContext(ctx)
 
+	// Expose the buffered body so middlewares can replay the request as well
+	if bodyBytes != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
+	}
+
 	for attempt := 1; attempt <= c.Retries; attempt++ {
 		// Restore request body for each attempt
 		if bodyBytes != nil {
-			req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			req.Body, _ = req.GetBody()
 		}
 
 		resp, err := c.HttpClient.Do(req)
@@ -107,8 +214,8 @@ func (c *client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 				slog.Int("attempt", attempt),
 				slog.Int("max_retries", c.Retries),
 				slog.String("method", req.Method),
-				slog.String("url", req.URL.String()),
-				slog.Any("error", err),
+				slog.String("url", c.redactor.URL(req.URL)),
+				slog.Any("error", c.redactor.Error(err)),
 			)
 
 			// Don't retry if it's the last attempt
@@ -116,6 +223,15 @@ func (c *client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 				return nil, fmt.Errorf("request failed after %d attempts: %w", c.Retries, lastErr)
 			}
 
+			// Don't retry errors that will not go away on their own
+			if !isRetryableError(err) {
+				return nil, fmt.Errorf("request failed after %d attempts: %w", attempt, lastErr)
+			}
+
+			if err := c.checkTimeForRetry(ctx, attempt); err != nil {
+				return nil, err
+			}
+
 			// Wait before retry with exponential backoff
 			c.waitBeforeRetry(ctx, attempt)
 			continue
@@ -126,11 +242,15 @@ func (c *client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 			// Close the response body before retry
 			_ = resp.Body.Close()
 
+			if err := c.checkTimeForRetry(ctx, attempt); err != nil {
+				return nil, err
+			}
+
 			c.Logger.WarnContext(ctx, "retrying due to status code",
 				slog.Int("status", resp.StatusCode),
 				slog.Int("attempt", attempt),
 				slog.Int("max_retries", c.Retries),
-				slog.String("url", req.URL.String()),
+				slog.String("url", c.redactor.URL(req.URL)),
 			)
 
 			c.waitBeforeRetry(ctx, attempt)
@@ -159,8 +279,51 @@ func (c *client) shouldRetry(statusCode int) bool {
 		(statusCode >= 500 && statusCode < 600)
 }
 
-// waitBeforeRetry implements exponential backoff
-func (c *client) waitBeforeRetry(ctx context.Context, attempt int) {
+// isRetryableError reports whether a failed attempt may succeed when retried
+func isRetryableError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, ErrCertificatePinMismatch),
+		errors.Is(err, ErrDestinationBlocked),
+		errors.Is(err, ErrRedirectBlocked),
+		errors.As(err, &certErr),
+		errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &invalidCertErr):
+		return false
+	}
+	return true
+}
+
+// checkTimeForRetry returns an error if the context deadline would pass
+// before the next attempt could even be sent
+func (c *client) checkTimeForRetry(ctx context.Context, attempt int) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	delay := c.retryDelay(attempt)
+	if time.Until(deadline) > delay {
+		return nil
+	}
+
+	c.Logger.WarnContext(ctx, "context deadline leaves no time for another attempt",
+		slog.Int("attempt", attempt),
+		slog.Int("max_retries", c.Retries),
+		slog.Duration("delay", delay),
+		slog.Time("deadline", deadline),
+	)
+	return fmt.Errorf("request failed after %d attempts: %w: %w", attempt, ErrNoTimeForRetry, context.DeadlineExceeded)
+}
+
+// retryDelay returns the exponential backoff delay after attempt
+func (c *client) retryDelay(attempt int) time.Duration {
 	// Exponential backoff: delay * 2^(attempt-1)
 	delay := c.RetryDelay * time.Duration(1<<uint(attempt-1))
 
@@ -168,6 +331,12 @@ func (c *client) waitBeforeRetry(ctx context.Context, attempt int) {
 	if delay > c.MaxRetryWait {
 		delay = c.MaxRetryWait
 	}
+	return delay
+}
+
+// waitBeforeRetry implements exponential backoff
+func (c *client) waitBeforeRetry(ctx context.Context, attempt int) {
+	delay := c.retryDelay(attempt)
 
 	c.Logger.DebugContext(ctx, "waiting before retry",
 		slog.Duration("delay", delay),
@@ -182,3 +351,16 @@ func (c *client) waitBeforeRetry(ctx context.Context, attempt int) {
 		return
 	}
 }
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,6 +1,7 @@
 package httpx_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -8,10 +9,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/extosoft-devsecops/httpx"
+	"github.com/extosoft-devsecops/httpx/logger"
 )
 
 // mockRoundTripper implements http.RoundTripper for testing
@@ -518,3 +521,84 @@ func (e *errorReader) Read(p []byte) (n int, err error) {
 func (e *errorReader) Close() error {
 	return nil
 }
+
+func TestWithLogRedaction(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	client := httpx.New(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		httpx.WithRetries(2),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithLogRedaction(logger.RedactQueryParams("signature")),
+	)
+
+	target := strings.Replace(server.URL, "http://", "http://user:hunter2@", 1) + "/items?api_key=k3y&Signature=s1gned&page=2"
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	req, _ = http.NewRequest(http.MethodGet, closed.URL+"/?token=t0ken", nil)
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Fatal("expected error for closed server")
+	}
+
+	output := logs.String()
+	for _, secret := range []string{"hunter2", "k3y", "s1gned", "t0ken"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("expected %q to be redacted, got:\n%s", secret, output)
+		}
+	}
+	for _, want := range []string{
+		`msg="retrying due to status code"`,
+		`msg="request attempt failed"`,
+		"/items?api_key=REDACTED&Signature=REDACTED&page=2",
+		"http://REDACTED@127.0.0.1",
+		"/?token=REDACTED",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected logs to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestWithLoggingOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "test")
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	client := httpx.New(slog.New(slog.NewTextHandler(&logs, nil)),
+		httpx.WithLoggingOptions(logger.WithHeaderLogging(true), logger.WithHeaderAllowlist("Authorization", "X-Served-By")),
+		httpx.WithLogRedaction(logger.RedactHeaders("X-Served-By")),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("User-Agent", "test-agent")
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	output := logs.String()
+	want := "request_headers.Authorization=REDACTED response_headers.X-Served-By=REDACTED"
+	if !strings.Contains(output, want) {
+		t.Errorf("expected log line containing %q, got:\n%s", want, output)
+	}
+	if strings.Contains(output, "secret") || strings.Contains(output, "test-agent") {
+		t.Errorf("expected only allowed headers, masked, got:\n%s", output)
+	}
+}
@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// binarySummarySize is how many bytes of a binary body are logged in hex
+const binarySummarySize = 64
+
+// JSONBodyFormat is how JSON bodies are logged.
+type JSONBodyFormat int
+
+const (
+	// JSONBodyStructured logs JSON bodies as nested slog attributes.
+	JSONBodyStructured JSONBodyFormat = iota
+	// JSONBodyPretty logs JSON bodies as indented text.
+	JSONBodyPretty
+)
+
+// BinaryBodyMode is how bodies that are not text are logged.
+type BinaryBodyMode int
+
+const (
+	// BinaryBodyHex logs the content type, size and first bytes in hex.
+	BinaryBodyHex BinaryBodyMode = iota
+	// BinaryBodySkip does not log binary bodies at all.
+	BinaryBodySkip
+)
+
+// WithJSONBodyFormat sets how JSON bodies are logged (default: JSONBodyStructured).
+// Bodies larger than the maximum body size are logged as truncated text.
+func WithJSONBodyFormat(format JSONBodyFormat) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.jsonFormat = format }
+}
+
+// WithBinaryBodyLogging sets how binary bodies such as images or protobuf are
+// logged (default: BinaryBodyHex).
+func WithBinaryBodyLogging(mode BinaryBodyMode) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.binaryMode = mode }
+}
+
+// logBody logs a body according to its content type. Every line has the size
+// of the body; a truncated body is marked with truncated and logged_size.
+// Sizes count decoded bytes: a gzip body also has encoded_size, the size
+// received, and has no size when decoding stopped past the maximum body size.
+func (l *LoggingRoundTripper) logBody(ctx context.Context, msg string, header http.Header, data []byte) {
+	size := len(data)
+	var encodingAttrs []any
+
+	contentType := header.Get("Content-Type")
+	if strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		// Only the logged copy is decoded, at most one byte past the limit
+		// to detect truncation without inflating arbitrarily large bodies
+		decoded, err := gunzip(data, l.maxBodySize+1)
+		if err != nil {
+			contentType = "application/gzip"
+		} else {
+			encodingAttrs = []any{slog.String("encoding", "gzip"), slog.Int("encoded_size", len(data))}
+			data = decoded
+			size = len(decoded)
+			if int64(size) > l.maxBodySize {
+				size = -1
+			}
+		}
+	}
+	if contentType == "" {
+		contentType = detectContentType(data)
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	var attrs []any
+	if size >= 0 {
+		attrs = append(attrs, slog.Int("size", size))
+	}
+	attrs = append(attrs, encodingAttrs...)
+
+	if !isTextMediaType(mediaType) {
+		if l.binaryMode == BinaryBodySkip {
+			return
+		}
+		summary := data[:min(len(data), binarySummarySize, int(l.maxBodySize))]
+		attrs = append(attrs,
+			slog.String("content_type", mediaType),
+			slog.String("body_hex", hex.EncodeToString(summary)),
+		)
+		l.logger.DebugContext(ctx, msg, append(attrs, truncationAttrs(len(data), len(summary))...)...)
+		return
+	}
+
+	redacted := l.redactor.Body(contentType, data)
+	if isJSONMediaType(mediaType) && int64(len(redacted)) <= l.maxBodySize {
+		if attr, ok := l.jsonBodyAttr(redacted); ok {
+			l.logger.DebugContext(ctx, msg, append(attrs, attr)...)
+			return
+		}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		redacted = l.multipartLogBody(redacted, params["boundary"])
+	}
+
+	logged := redacted[:min(int64(len(redacted)), l.maxBodySize)]
+	attrs = append(attrs, slog.String("body", string(logged)))
+	l.logger.DebugContext(ctx, msg, append(attrs, truncationAttrs(len(redacted), len(logged))...)...)
+}
+
+// detectContentType sniffs the content type of a body sent without one,
+// telling JSON apart from plain text so that its fields are redacted
+func detectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "text/plain") {
+		if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return "application/json"
+		}
+	}
+	return contentType
+}
+
+// multipartLogBody logs each part of a multipart body according to its own
+// content type: binary parts such as uploaded files are replaced with their
+// content type, size and first bytes in hex, or only keep their headers with
+// BinaryBodySkip. A body that cannot be parsed is returned as is.
+func (l *LoggingRoundTripper) multipartLogBody(body []byte, boundary string) []byte {
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return body
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return body
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return body
+		}
+
+		w, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return body
+		}
+		partType := part.Header.Get("Content-Type")
+		if partType == "" {
+			partType = http.DetectContentType(content)
+		}
+		mediaType, _, _ := mime.ParseMediaType(partType)
+
+		switch {
+		case isTextMediaType(mediaType):
+			_, _ = w.Write(content)
+		case l.binaryMode == BinaryBodyHex:
+			summary := content[:min(len(content), binarySummarySize)]
+			_, _ = fmt.Fprintf(w, "[%s, %d bytes] %s", mediaType, len(content), hex.EncodeToString(summary))
+		}
+	}
+	_ = writer.Close()
+	return out.Bytes()
+}
+
+func truncationAttrs(size, logged int) []any {
+	if logged >= size {
+		return nil
+	}
+	return []any{slog.Bool("truncated", true), slog.Int("logged_size", logged)}
+}
+
+func (l *LoggingRoundTripper) jsonBodyAttr(data []byte) (slog.Attr, bool) {
+	if l.jsonFormat == JSONBodyPretty {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, data, "", "  "); err != nil {
+			return slog.Attr{}, false
+		}
+		return slog.String("body", pretty.String()), true
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return slog.Attr{}, false
+	}
+	return slog.Attr{Key: "body", Value: jsonLogValue(value)}, true
+}
+
+// jsonLogValue turns decoded JSON into slog values, objects into groups with
+// sorted keys
+func jsonLogValue(value any) slog.Value {
+	switch value := value.(type) {
+	case map[string]any:
+		attrs := make([]slog.Attr, 0, len(value))
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			attrs = append(attrs, slog.Attr{Key: key, Value: jsonLogValue(value[key])})
+		}
+		return slog.GroupValue(attrs...)
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return slog.Int64Value(n)
+		}
+		if f, err := value.Float64(); err == nil {
+			return slog.Float64Value(f)
+		}
+		return slog.StringValue(value.String())
+	}
+	return slog.AnyValue(value)
+}
+
+func gunzip(data []byte, limit int64) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit))
+	if err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasPrefix(mediaType, "multipart/"),
+		isJSONMediaType(mediaType),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/xml",
+		"application/x-www-form-urlencoded",
+		"application/javascript",
+		"application/graphql",
+		"application/x-ndjson",
+		"application/yaml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package logger_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// logResponseBody sends a request through a LoggingRoundTripper answering
+// with body and returns the parsed "http response body" line, nil if there
+// is none
+func logResponseBody(t *testing.T, header http.Header, body []byte, opts ...logger.LoggingOption) map[string]any {
+	t.Helper()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	rt := logger.NewLoggingRoundTripper(log, &mockRoundTripper{response: &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Header:     header,
+	}}, append([]logger.LoggingOption{logger.WithBodyLogging(true)}, opts...)...)
+
+	resp, err := rt.RoundTrip(httptest.NewRequest("GET", "http://example.com/api", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	received, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(received, body) {
+		t.Errorf("expected response body to be returned unchanged, got %q", received)
+	}
+
+	for _, line := range bytes.Split(logBuf.Bytes(), []byte("\n")) {
+		var entry map[string]any
+		if json.Unmarshal(line, &entry) == nil && entry["msg"] == "http response body" {
+			return entry
+		}
+	}
+	return nil
+}
+
+func contentType(value string) http.Header {
+	header := make(http.Header)
+	if value != "" {
+		header.Set("Content-Type", value)
+	}
+	return header
+}
+
+func TestLoggingRoundTripper_JSONBody(t *testing.T) {
+	body := []byte(`{"user":{"name":"alice","password":"secret"},"roles":["admin","dev"],"age":42}`)
+
+	t.Run("structured", func(t *testing.T) {
+		entry := logResponseBody(t, contentType("application/json"), body)
+
+		logged, ok := entry["body"].(map[string]any)
+		if !ok {
+			t.Fatalf("expected body to be logged as attributes, got %v", entry["body"])
+		}
+		user, _ := logged["user"].(map[string]any)
+		if user["name"] != "alice" || user["password"] != logger.Redacted {
+			t.Errorf("expected nested redacted attributes, got %v", logged)
+		}
+		if logged["age"] != float64(42) {
+			t.Errorf("expected numbers to stay numbers, got %v", logged["age"])
+		}
+		if roles, _ := logged["roles"].([]any); len(roles) != 2 {
+			t.Errorf("expected arrays to be kept, got %v", logged["roles"])
+		}
+		if entry["size"] != float64(len(body)) {
+			t.Errorf("expected size %d, got %v", len(body), entry["size"])
+		}
+	})
+
+	t.Run("pretty", func(t *testing.T) {
+		entry := logResponseBody(t, contentType("application/json"), body, logger.WithJSONBodyFormat(logger.JSONBodyPretty))
+
+		logged, _ := entry["body"].(string)
+		if !strings.Contains(logged, "\n  \"roles\": [\n") || strings.Contains(logged, "secret") {
+			t.Errorf("expected indented redacted JSON, got %q", logged)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		entry := logResponseBody(t, contentType("application/json"), body, logger.WithMaxBodySize(20))
+
+		logged, _ := entry["body"].(string)
+		if len(logged) != 20 || entry["truncated"] != true || entry["logged_size"] != float64(20) {
+			t.Errorf("expected truncated text body, got %v", entry)
+		}
+	})
+}
+
+func TestLoggingRoundTripper_BinaryBody(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0xff}, 200)...)
+
+	t.Run("hex summary", func(t *testing.T) {
+		entry := logResponseBody(t, contentType("image/png"), png)
+
+		if _, ok := entry["body"]; ok {
+			t.Errorf("expected no raw body for binary content, got %v", entry["body"])
+		}
+		hexBody, _ := entry["body_hex"].(string)
+		if !strings.HasPrefix(hexBody, "89504e470d0a1a0a") || len(hexBody) != 128 {
+			t.Errorf("expected hex summary of the first 64 bytes, got %q", hexBody)
+		}
+		if entry["content_type"] != "image/png" || entry["size"] != float64(len(png)) {
+			t.Errorf("expected content type and size, got %v", entry)
+		}
+		if entry["truncated"] != true || entry["logged_size"] != float64(64) {
+			t.Errorf("expected truncation to be marked, got %v", entry)
+		}
+	})
+
+	t.Run("detected without content type", func(t *testing.T) {
+		entry := logResponseBody(t, contentType(""), png)
+		if entry["content_type"] != "image/png" {
+			t.Errorf("expected detected content type, got %v", entry)
+		}
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		entry := logResponseBody(t, contentType("application/x-protobuf"), []byte{0x08, 0x96, 0x01})
+		if entry["body_hex"] != "089601" || entry["truncated"] != nil {
+			t.Errorf("expected full hex of short binary body, got %v", entry)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		if entry := logResponseBody(t, contentType("image/png"), png, logger.WithBinaryBodyLogging(logger.BinaryBodySkip)); entry != nil {
+			t.Errorf("expected binary body not to be logged, got %v", entry)
+		}
+		if entry := logResponseBody(t, contentType("text/plain"), []byte("hello"), logger.WithBinaryBodyLogging(logger.BinaryBodySkip)); entry["body"] != "hello" {
+			t.Errorf("expected text body to still be logged, got %v", entry)
+		}
+	})
+}
+
+func TestLoggingRoundTripper_GzipBody(t *testing.T) {
+	plain := []byte(`{"token":"abc","ssn":"123-45-6789","items":[1,2,3]}`)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write(plain)
+	_ = gz.Close()
+
+	header := contentType("application/json")
+	header.Set("Content-Encoding", "gzip")
+
+	t.Run("decoded for logging", func(t *testing.T) {
+		entry := logResponseBody(t, header, compressed.Bytes())
+
+		logged, ok := entry["body"].(map[string]any)
+		if !ok || logged["token"] != "abc" || logged["ssn"] != logger.Redacted {
+			t.Errorf("expected decoded and redacted body, got %v", entry)
+		}
+		if entry["encoding"] != "gzip" || entry["encoded_size"] != float64(compressed.Len()) || entry["size"] != float64(len(plain)) {
+			t.Errorf("expected encoding, compressed and decoded size, got %v", entry)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		entry := logResponseBody(t, header, compressed.Bytes(), logger.WithMaxBodySize(30))
+
+		logged, _ := entry["body"].(string)
+		if len(logged) != 30 || entry["truncated"] != true || entry["logged_size"] != float64(30) || strings.Contains(logged, "123-45") {
+			t.Errorf("expected truncated redacted body, got %v", entry)
+		}
+		// The decoded size is unknown once decoding stopped at the limit
+		if _, ok := entry["size"]; ok || entry["encoded_size"] != float64(compressed.Len()) {
+			t.Errorf("expected only the compressed size, got %v", entry)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		entry := logResponseBody(t, header, []byte("not gzip"))
+		if entry["content_type"] != "application/gzip" || entry["body_hex"] == nil {
+			t.Errorf("expected undecodable body to be logged as binary, got %v", entry)
+		}
+	})
+}
+
+func TestLoggingRoundTripper_SniffedJSONBody(t *testing.T) {
+	entry := logResponseBody(t, contentType(""), []byte(`{"user":"alice","password":"secret"}`))
+
+	logged, ok := entry["body"].(map[string]any)
+	if !ok || logged["user"] != "alice" || logged["password"] != logger.Redacted {
+		t.Errorf("expected JSON without content type to be redacted, got %v", entry)
+	}
+}
+
+func TestLoggingRoundTripper_MultipartBody(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0xff}, 200)...)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("title", "holiday")
+	_ = w.WriteField("password", "secret")
+	file, _ := w.CreateFormFile("photo", "photo.png")
+	_, _ = file.Write(png)
+	_ = w.Close()
+
+	t.Run("hex summary of binary parts", func(t *testing.T) {
+		entry := logResponseBody(t, contentType(w.FormDataContentType()), body.Bytes())
+
+		logged, _ := entry["body"].(string)
+		if !strings.Contains(logged, "holiday") || strings.Contains(logged, "secret") {
+			t.Errorf("expected redacted text parts, got %q", logged)
+		}
+		if strings.Contains(logged, "PNG") || !strings.Contains(logged, "[application/octet-stream, 208 bytes] 89504e470d0a1a0a") {
+			t.Errorf("expected binary part summary instead of raw bytes, got %q", logged)
+		}
+		if !strings.Contains(logged, `filename="photo.png"`) {
+			t.Errorf("expected part headers to be kept, got %q", logged)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		entry := logResponseBody(t, contentType(w.FormDataContentType()), body.Bytes(), logger.WithBinaryBodyLogging(logger.BinaryBodySkip))
+
+		logged, _ := entry["body"].(string)
+		if strings.Contains(logged, "89504e47") || strings.Contains(logged, "PNG") || !strings.Contains(logged, `filename="photo.png"`) {
+			t.Errorf("expected only the headers of binary parts, got %q", logged)
+		}
+	})
+}
+
+func TestLoggingRoundTripper_TextBodyTruncation(t *testing.T) {
+	entry := logResponseBody(t, contentType("text/plain"), []byte(strings.Repeat("a", 1000)), logger.WithMaxBodySize(100))
+
+	if entry["size"] != float64(1000) || entry["logged_size"] != float64(100) || entry["truncated"] != true {
+		t.Errorf("expected original and logged size, got %v", entry)
+	}
+	if logged, _ := entry["body"].(string); len(logged) != 100 {
+		t.Errorf("expected 100 logged bytes, got %d", len(logged))
+	}
+
+	entry = logResponseBody(t, contentType("text/plain"), []byte("short"), logger.WithMaxBodySize(100))
+	if _, ok := entry["truncated"]; ok {
+		t.Errorf("expected no truncation marker, got %v", entry)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -16,6 +19,13 @@ type LoggingRoundTripper struct {
 	next        http.RoundTripper
 	logBodies   bool
 	maxBodySize int64
+	redactor    *Redactor
+	jsonFormat  JSONBodyFormat
+	binaryMode  BinaryBodyMode
+
+	logHeaders      bool
+	headerAllowlist map[string]struct{}
+	headerDenylist  map[string]struct{}
 }
 
 type LoggingOption func(*LoggingRoundTripper)
@@ -28,6 +38,41 @@ func WithMaxBodySize(size int64) LoggingOption {
 	return func(l *LoggingRoundTripper) { l.maxBodySize = size }
 }
 
+// WithRedactor sets the Redactor applied to every URL, error and body that
+// is logged (default: NewRedactor()).
+func WithRedactor(r *Redactor) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.redactor = r }
+}
+
+// WithHeaderLogging enables request and response header logging (default:
+// false). Headers are added to the "http request completed" and "http request
+// failed" lines as the request_headers and response_headers groups, with the
+// values of headers redacted by the Redactor masked.
+func WithHeaderLogging(enabled bool) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.logHeaders = enabled }
+}
+
+// WithHeaderAllowlist only logs the named headers when header logging is
+// enabled. Masked headers stay masked.
+func WithHeaderAllowlist(names ...string) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.headerAllowlist = headerSet(l.headerAllowlist, names) }
+}
+
+// WithHeaderDenylist never logs the named headers, not even masked.
+func WithHeaderDenylist(names ...string) LoggingOption {
+	return func(l *LoggingRoundTripper) { l.headerDenylist = headerSet(l.headerDenylist, names) }
+}
+
+func headerSet(set map[string]struct{}, names []string) map[string]struct{} {
+	if set == nil {
+		set = make(map[string]struct{}, len(names))
+	}
+	for _, name := range names {
+		set[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	return set
+}
+
 func NewLoggingRoundTripper(logger *slog.Logger, next http.RoundTripper, opts ...LoggingOption) *LoggingRoundTripper {
 	if next == nil {
 		next = http.DefaultTransport
@@ -38,6 +83,7 @@ func NewLoggingRoundTripper(logger *slog.Logger, next http.RoundTripper, opts ..
 		next:        next,
 		logBodies:   false,
 		maxBodySize: defaultMaxBodySize,
+		redactor:    NewRedactor(),
 	}
 
 	for _, opt := range opts {
@@ -70,7 +116,7 @@ func (l *LoggingRoundTripper) logRequest(ctx context.Context, req *http.Request)
 		return
 	}
 
-	bodyData, newReader, err := readBody(req.Body, l.maxBodySize)
+	bodyData, newReader, err := readBody(req.Body)
 	req.Body = newReader
 
 	if err != nil {
@@ -78,41 +124,78 @@ func (l *LoggingRoundTripper) logRequest(ctx context.Context, req *http.Request)
 		return
 	}
 
-	l.logger.DebugContext(ctx, "http request body", slog.String("body", string(bodyData)))
+	l.logBody(ctx, "http request body", req.Header, bodyData)
 }
 
 func (l *LoggingRoundTripper) logRequestError(ctx context.Context, req *http.Request, duration time.Duration, err error) {
-	l.logger.ErrorContext(ctx, "http request failed",
+	attrs := []any{
 		slog.String("method", req.Method),
-		slog.String("url", req.URL.String()),
+		slog.String("url", l.redactor.URL(req.URL)),
 		slog.Duration("duration", duration),
-		slog.Any("error", err),
-	)
+		slog.Any("error", l.redactor.Error(err)),
+	}
+	if l.logHeaders {
+		attrs = append(attrs, l.headerGroup("request_headers", req.Header))
+	}
+	l.logger.ErrorContext(ctx, "http request failed", attrs...)
 }
 
 func (l *LoggingRoundTripper) logResponse(ctx context.Context, req *http.Request, resp *http.Response, duration time.Duration) {
 	if l.logBodies && resp.Body != nil {
-		bodyData, newReader, err := readBody(resp.Body, l.maxBodySize)
+		bodyData, newReader, err := readBody(resp.Body)
 		resp.Body = newReader
 
 		if err != nil {
 			l.logger.WarnContext(ctx, "failed to read response body", slog.Any("error", err))
 		} else {
-			l.logger.DebugContext(ctx, "http response body", slog.String("body", string(bodyData)))
+			l.logBody(ctx, "http response body", resp.Header, bodyData)
 		}
 	}
 
-	l.logger.InfoContext(ctx, "http request completed",
+	attrs := []any{
 		slog.String("method", req.Method),
-		slog.String("url", req.URL.String()),
+		slog.String("url", l.redactor.URL(req.URL)),
 		slog.Int("status", resp.StatusCode),
 		slog.Duration("duration", duration),
-	)
+	}
+	if l.logHeaders {
+		attrs = append(attrs,
+			l.headerGroup("request_headers", req.Header),
+			l.headerGroup("response_headers", resp.Header),
+		)
+	}
+	l.logger.InfoContext(ctx, "http request completed", attrs...)
 }
 
-// readBody reads the body content, limits it for logging, and returns a new reader
-// so the body can be read again by subsequent handlers.
-func readBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, error) {
+// headerGroup returns the headers to log as a group sorted by name, multiple
+// values joined by ", "
+func (l *LoggingRoundTripper) headerGroup(key string, header http.Header) slog.Attr {
+	values := make(map[string][]string, len(header))
+	for name, v := range header {
+		name = http.CanonicalHeaderKey(name)
+		if _, denied := l.headerDenylist[name]; denied {
+			continue
+		}
+		if _, allowed := l.headerAllowlist[name]; l.headerAllowlist != nil && !allowed {
+			continue
+		}
+		values[name] = append(values[name], v...)
+	}
+
+	attrs := make([]any, 0, len(values))
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		value := Redacted
+		if !l.redactor.IsRedactedHeader(name) {
+			value = strings.Join(values[name], ", ")
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group(key, attrs...)
+}
+
+// readBody reads the body content and returns a new reader so the body can be
+// read again by subsequent handlers.
+func readBody(body io.ReadCloser) ([]byte, io.ReadCloser, error) {
 	data, err := io.ReadAll(body)
 	_ = body.Close() // Close the original body after reading
 
@@ -120,12 +203,6 @@ func readBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, error) {
 		return nil, io.NopCloser(bytes.NewReader(nil)), err
 	}
 
-	// Determine how much data to return for logging
-	logBytes := data
-	if int64(len(data)) > limit {
-		logBytes = data[:limit]
-	}
-
 	// Return a new reader with the full data so it can be read again
-	return logBytes, io.NopCloser(bytes.NewReader(data)), nil
+	return data, io.NopCloser(bytes.NewReader(data)), nil
 }
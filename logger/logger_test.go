@@ -3,6 +3,7 @@ package logger_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
@@ -579,3 +580,129 @@ func TestLoggingRoundTripper_StatusCodes(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggingRoundTripper_HeaderLogging(t *testing.T) {
+	newResponse := func() *http.Response {
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json")
+		header.Add("Set-Cookie", "session=abc")
+		header.Add("Vary", "Accept")
+		header.Add("Vary", "Accept-Encoding")
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("")), Header: header}
+	}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer secret-token")
+		req.Header.Set("X-Request-Id", "req-1")
+		return req
+	}
+
+	logLine := func(t *testing.T, opts ...logger.LoggingOption) map[string]any {
+		t.Helper()
+
+		logBuf := &bytes.Buffer{}
+		log := slog.New(slog.NewJSONHandler(logBuf, nil))
+		rt := logger.NewLoggingRoundTripper(log, &mockRoundTripper{response: newResponse()}, opts...)
+		if _, err := rt.RoundTrip(newRequest()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(logBuf.String(), "secret-token") || strings.Contains(logBuf.String(), "session=abc") {
+			t.Errorf("expected credential headers to be masked, got %s", logBuf.String())
+		}
+
+		var line map[string]any
+		if err := json.Unmarshal(logBuf.Bytes(), &line); err != nil {
+			t.Fatalf("failed to parse log line: %v", err)
+		}
+		return line
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		line := logLine(t)
+		if _, ok := line["request_headers"]; ok {
+			t.Errorf("expected no headers in logs, got %v", line)
+		}
+	})
+
+	t.Run("all headers", func(t *testing.T) {
+		line := logLine(t, logger.WithHeaderLogging(true))
+
+		request, _ := line["request_headers"].(map[string]any)
+		want := map[string]any{"Accept": "application/json", "Authorization": logger.Redacted, "X-Request-Id": "req-1"}
+		if len(request) != len(want) {
+			t.Errorf("expected request headers %v, got %v", want, request)
+		}
+		for name, value := range want {
+			if request[name] != value {
+				t.Errorf("expected request header %s=%v, got %v", name, value, request[name])
+			}
+		}
+
+		response, _ := line["response_headers"].(map[string]any)
+		if response["Set-Cookie"] != logger.Redacted || response["Vary"] != "Accept, Accept-Encoding" {
+			t.Errorf("unexpected response headers %v", response)
+		}
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		line := logLine(t, logger.WithHeaderLogging(true), logger.WithHeaderAllowlist("accept", "authorization", "content-type"))
+
+		request, _ := line["request_headers"].(map[string]any)
+		if len(request) != 2 || request["Accept"] != "application/json" || request["Authorization"] != logger.Redacted {
+			t.Errorf("expected only allowed request headers, got %v", request)
+		}
+		response, _ := line["response_headers"].(map[string]any)
+		if len(response) != 1 || response["Content-Type"] != "application/json" {
+			t.Errorf("expected only allowed response headers, got %v", response)
+		}
+	})
+
+	t.Run("denylist", func(t *testing.T) {
+		line := logLine(t, logger.WithHeaderLogging(true), logger.WithHeaderDenylist("Authorization", "x-request-id"))
+
+		request, _ := line["request_headers"].(map[string]any)
+		if len(request) != 1 || request["Accept"] != "application/json" {
+			t.Errorf("expected denied headers to be left out, got %v", request)
+		}
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		logBuf := &bytes.Buffer{}
+		log := slog.New(slog.NewJSONHandler(logBuf, nil))
+		rt := logger.NewLoggingRoundTripper(log, &mockRoundTripper{err: errors.New("connection reset")},
+			logger.WithHeaderLogging(true))
+
+		_, _ = rt.RoundTrip(newRequest())
+		if !strings.Contains(logBuf.String(), `"request_headers":{"Accept":"application/json","Authorization":"REDACTED","X-Request-Id":"req-1"}`) {
+			t.Errorf("expected request headers on failure, got %s", logBuf.String())
+		}
+	})
+
+	t.Run("default credential headers", func(t *testing.T) {
+		logBuf := &bytes.Buffer{}
+		log := slog.New(slog.NewJSONHandler(logBuf, nil))
+		rt := logger.NewLoggingRoundTripper(log, &mockRoundTripper{response: newResponse()}, logger.WithHeaderLogging(true))
+
+		credentials := []string{"X-Amz-Security-Token", "X-Api-Key", "X-Auth-Token", "X-Csrf-Token"}
+		req := newRequest()
+		for _, name := range credentials {
+			req.Header.Set(name, "secret-"+name)
+		}
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if strings.Contains(logBuf.String(), "secret-") {
+			t.Errorf("expected credential headers to be masked, got %s", logBuf.String())
+		}
+		var line map[string]any
+		_ = json.Unmarshal(logBuf.Bytes(), &line)
+		request, _ := line["request_headers"].(map[string]any)
+		for _, name := range credentials {
+			if request[name] != logger.Redacted {
+				t.Errorf("expected %s to be redacted, got %v", name, request[name])
+			}
+		}
+	})
+}
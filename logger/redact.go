@@ -0,0 +1,301 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces secret values in log output.
+const Redacted = "REDACTED"
+
+var (
+	defaultRedactedHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+		"X-Amz-Security-Token", "X-Api-Key", "X-Auth-Token", "X-Csrf-Token",
+	}
+	defaultRedactedQueryParams = []string{"api_key", "token"}
+	defaultRedactedBodyFields  = []string{"password", "cardNumber", "ssn"}
+)
+
+// Redactor masks secrets in what is logged about requests: the values of
+// sensitive headers, query parameters and body fields, and URL userinfo. Names
+// are matched case-insensitively.
+type Redactor struct {
+	headers     map[string]struct{}
+	queryParams map[string]struct{}
+	bodyFields  map[string]struct{}
+	bodyPaths   [][]string
+}
+
+type RedactOption func(*Redactor)
+
+// RedactHeaders adds headers whose values are redacted.
+func RedactHeaders(names ...string) RedactOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			r.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+		}
+	}
+}
+
+// RedactQueryParams adds query parameters whose values are redacted.
+func RedactQueryParams(names ...string) RedactOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			r.queryParams[strings.ToLower(name)] = struct{}{}
+		}
+	}
+}
+
+// RedactBodyFields adds body fields whose values are redacted. A name such as
+// "password" matches JSON keys at any depth as well as form and multipart
+// fields. A path such as "$.user.card.number" only matches that JSON field;
+// array indices like "items[*]" are ignored since every element is matched.
+func RedactBodyFields(names ...string) RedactOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if !strings.ContainsAny(name, ".[$") {
+				r.bodyFields[name] = struct{}{}
+				continue
+			}
+			path := strings.TrimPrefix(arrayIndexPattern.ReplaceAllString(name, ""), "$")
+			r.bodyPaths = append(r.bodyPaths, strings.Split(strings.TrimPrefix(path, "."), "."))
+		}
+	}
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+// NewRedactor returns a Redactor for the Authorization, Proxy-Authorization,
+// Cookie, Set-Cookie, X-Amz-Security-Token, X-Api-Key, X-Auth-Token and
+// X-Csrf-Token headers, the api_key and token query parameters and the
+// password, cardNumber and ssn body fields, extended by opts.
+func NewRedactor(opts ...RedactOption) *Redactor {
+	r := &Redactor{
+		headers:     make(map[string]struct{}),
+		queryParams: make(map[string]struct{}),
+		bodyFields:  make(map[string]struct{}),
+	}
+	RedactHeaders(defaultRedactedHeaders...)(r)
+	RedactQueryParams(defaultRedactedQueryParams...)(r)
+	RedactBodyFields(defaultRedactedBodyFields...)(r)
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// IsRedactedHeader reports whether the value of the header name is redacted.
+func (r *Redactor) IsRedactedHeader(name string) bool {
+	_, ok := r.headers[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// Header returns a copy of h with the values of redacted headers replaced.
+func (r *Redactor) Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		if r.IsRedactedHeader(name) {
+			values = []string{Redacted}
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// URL returns u as a string with its userinfo and the values of redacted query
+// parameters replaced. The order of the query parameters is kept.
+func (r *Redactor) URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	safe := *u
+	if safe.User != nil {
+		safe.User = url.User(Redacted)
+	}
+	if safe.RawQuery != "" {
+		safe.RawQuery = redactQuery(safe.RawQuery, r.queryParams)
+	}
+	return safe.String()
+}
+
+// redactQuery replaces the values of the named parameters in a URL-encoded
+// query, keeping the order of the parameters
+func redactQuery(query string, names map[string]struct{}) string {
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if _, ok := names[strings.ToLower(name)]; ok && hasValue {
+			params[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Body returns body with the values of redacted fields replaced, according to
+// contentType: JSON, URL-encoded forms and multipart forms are supported, other
+// bodies are returned as is. Re-encoded JSON has its object keys sorted.
+func (r *Redactor) Body(contentType string, body []byte) []byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || len(body) == 0 {
+		return body
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return r.redactJSON(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		return []byte(redactQuery(string(body), r.bodyFields))
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return r.redactMultipart(body, params["boundary"])
+	}
+	return body
+}
+
+func (r *Redactor) redactJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return r.redactJSONText(body)
+	}
+	redacted, err := json.Marshal(r.redactJSONValue(value, nil))
+	if err != nil {
+		return r.redactJSONText(body)
+	}
+	return redacted
+}
+
+func (r *Redactor) redactJSONValue(value any, path []string) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, child := range value {
+			childPath := append(path[:len(path):len(path)], strings.ToLower(key))
+			if r.isRedactedField(childPath) {
+				value[key] = Redacted
+				continue
+			}
+			value[key] = r.redactJSONValue(child, childPath)
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = r.redactJSONValue(child, path)
+		}
+	}
+	return value
+}
+
+func (r *Redactor) isRedactedField(path []string) bool {
+	if _, ok := r.bodyFields[path[len(path)-1]]; ok {
+		return true
+	}
+	for _, redacted := range r.bodyPaths {
+		if slices.Equal(redacted, path) {
+			return true
+		}
+	}
+	return false
+}
+
+var jsonFieldPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,{}\[\]"]*)`)
+
+// redactJSONText masks fields of a body that is not valid JSON, such as a
+// truncated document. Paths cannot be followed here, so every key named like
+// the last element of a path is masked as well.
+func (r *Redactor) redactJSONText(body []byte) []byte {
+	return jsonFieldPattern.ReplaceAllFunc(body, func(field []byte) []byte {
+		match := jsonFieldPattern.FindSubmatch(field)
+		key := strings.ToLower(string(match[1]))
+
+		redacted := false
+		if _, ok := r.bodyFields[key]; ok {
+			redacted = true
+		}
+		for _, path := range r.bodyPaths {
+			redacted = redacted || path[len(path)-1] == key
+		}
+		// Objects and arrays are not matched, only the fields inside them
+		if !redacted || len(match[3]) == 0 {
+			return field
+		}
+		return slices.Concat([]byte(`"`), match[1], []byte(`"`), match[2], []byte(`"`+Redacted+`"`))
+	})
+}
+
+// redactMultipart masks the values of redacted form fields, keeping file
+// parts. A body that cannot be parsed is left out entirely.
+func (r *Redactor) redactMultipart(body []byte, boundary string) []byte {
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return []byte(Redacted)
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return []byte(Redacted)
+		}
+
+		w, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return []byte(Redacted)
+		}
+		if _, ok := r.bodyFields[strings.ToLower(part.FormName())]; ok && part.FileName() == "" {
+			_, _ = io.WriteString(w, Redacted)
+		} else if _, err := io.Copy(w, part); err != nil {
+			return []byte(Redacted)
+		}
+	}
+	_ = writer.Close()
+	return out.Bytes()
+}
+
+// Error returns err with the URL of a wrapped *url.Error redacted in its
+// message. errors.Is and errors.As still see the original error.
+func (r *Redactor) Error(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return err
+	}
+
+	safe := r.URL(u)
+	if safe == urlErr.URL {
+		return err
+	}
+	return &redactedError{err: err, msg: strings.ReplaceAll(err.Error(), urlErr.URL, safe)}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
@@ -0,0 +1,306 @@
+package httpx
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	defaultJWTAssertionTTL = 5 * time.Minute
+)
+
+// OAuth2Config describes an OAuth2 token endpoint and the client credentials
+// used to authenticate against it.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// AuthInParams sends the client credentials in the request body instead
+	// of using HTTP Basic authentication
+	AuthInParams bool
+	// EndpointParams are extra parameters sent with every token request, e.g. audience
+	EndpointParams url.Values
+}
+
+// OAuth2Error is returned when the token endpoint rejects a token request (RFC 6749 §5.2).
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth2: %s: %s (status %d)", e.Code, e.Description, e.StatusCode)
+	}
+	return fmt.Sprintf("oauth2: %s (status %d)", e.Code, e.StatusCode)
+}
+
+// NewClientCredentialsSource returns a TokenSource using the client
+// credentials grant. Token requests are sent with tokenClient, so they get
+// its retries and logging.
+func NewClientCredentialsSource(tokenClient Client, cfg OAuth2Config) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		params := url.Values{"grant_type": {grantTypeClientCredentials}}
+		token, _, err := requestToken(ctx, tokenClient, cfg, params)
+		return token, err
+	})
+}
+
+// NewRefreshTokenSource returns a TokenSource using the refresh token grant.
+// When the token endpoint rotates the refresh token, the new one is used for
+// the following refreshes.
+func NewRefreshTokenSource(tokenClient Client, cfg OAuth2Config, refreshToken string) TokenSource {
+	return &refreshTokenSource{client: tokenClient, cfg: cfg, refreshToken: refreshToken}
+}
+
+type refreshTokenSource struct {
+	client Client
+	cfg    OAuth2Config
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (s *refreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	params := url.Values{
+		"grant_type":    {grantTypeRefreshToken},
+		"refresh_token": {s.refreshToken},
+	}
+	token, refreshToken, err := requestToken(ctx, s.client, s.cfg, params)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken != "" {
+		s.refreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// JWTAssertion describes the JWT signed for the JWT bearer grant (RFC 7523).
+type JWTAssertion struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	KeyID    string
+	// Key signs the assertion: *rsa.PrivateKey (RS256), *ecdsa.PrivateKey on
+	// P-256 (ES256) or []byte (HS256)
+	Key any
+	// TTL is how long the assertion is valid (default: 5 minutes)
+	TTL time.Duration
+	// Claims are extra claims added to the assertion
+	Claims map[string]any
+}
+
+// NewJWTBearerSource returns a TokenSource using the JWT bearer assertion
+// grant. A new assertion is signed for every token request.
+func NewJWTBearerSource(tokenClient Client, cfg OAuth2Config, assertion JWTAssertion) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		signed, err := assertion.sign(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign assertion: %w", err)
+		}
+		params := url.Values{
+			"grant_type": {grantTypeJWTBearer},
+			"assertion":  {signed},
+		}
+		token, _, err := requestToken(ctx, tokenClient, cfg, params)
+		return token, err
+	})
+}
+
+// tokenResponse is a successful token endpoint response (RFC 6749 §5.1)
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	RefreshToken string      `json:"refresh_token"`
+}
+
+// tokenErrorResponse is an error token endpoint response (RFC 6749 §5.2)
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken posts params to the token endpoint and returns the access token
+// and the refresh token, if any
+func requestToken(ctx context.Context, client Client, cfg OAuth2Config, params url.Values) (*Token, string, error) {
+	for key, values := range cfg.EndpointParams {
+		params[key] = values
+	}
+	if len(cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if cfg.AuthInParams {
+		params.Set("client_id", cfg.ClientID)
+		if cfg.ClientSecret != "" {
+			params.Set("client_secret", cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !cfg.AuthInParams && cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp tokenErrorResponse
+		_ = json.Unmarshal(body, &errResp)
+		if errResp.Error == "" {
+			errResp.Error = "invalid_response"
+		}
+		return nil, "", &OAuth2Error{
+			StatusCode:  resp.StatusCode,
+			Code:        errResp.Error,
+			Description: errResp.ErrorDescription,
+		}
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, "", errors.New("oauth2: token response has no access_token")
+	}
+
+	token := &Token{AccessToken: tokenResp.AccessToken, TokenType: tokenResp.TokenType}
+	if strings.EqualFold(token.TokenType, "bearer") {
+		token.TokenType = "Bearer"
+	}
+	if secs, err := strconv.ParseInt(tokenResp.ExpiresIn.String(), 10, 64); err == nil && secs > 0 {
+		token.Expiry = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	return token, tokenResp.RefreshToken, nil
+}
+
+// sign builds and signs the assertion JWT (RFC 7519)
+func (a JWTAssertion) sign(now time.Time) (string, error) {
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = defaultJWTAssertionTTL
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := map[string]any{}
+	for key, value := range a.Claims {
+		claims[key] = value
+	}
+	claims["iss"] = a.Issuer
+	claims["sub"] = a.Subject
+	claims["aud"] = a.Audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["jti"] = base64.RawURLEncoding.EncodeToString(jti)
+
+	var alg string
+	switch a.Key.(type) {
+	case *rsa.PrivateKey:
+		alg = "RS256"
+	case *ecdsa.PrivateKey:
+		alg = "ES256"
+	case []byte:
+		alg = "HS256"
+	default:
+		return "", fmt.Errorf("unsupported assertion key type %T", a.Key)
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if a.KeyID != "" {
+		header["kid"] = a.KeyID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	signature, err := signJWT(a.Key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func signJWT(key any, input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		return signECDSAP256(k, digest[:])
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// signECDSAP256 returns the fixed size r||s signature used by JWS and HTTP
+// message signatures instead of the ASN.1 encoding
+func signECDSAP256(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	if key.Curve.Params().BitSize != 256 {
+		return nil, errors.New("ecdsa key must use curve P-256")
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
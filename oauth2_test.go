@@ -0,0 +1,280 @@
+package httpx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// newTokenServer returns a token endpoint that hands out access-1, access-2, ...
+// after validating the request with check
+func newTokenServer(t *testing.T, check func(r *http.Request) string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse token request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if problem := check(r); problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": problem})
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("access-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    3600,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func newAPIServer(t *testing.T, wantAuth string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != wantAuth {
+			t.Errorf("expected Authorization '%s', got '%s'", wantAuth, got)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNewClientCredentialsSource(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, func(r *http.Request) string {
+		id, secret, ok := r.BasicAuth()
+		switch {
+		case !ok || id != "my-client" || secret != "s3cr3t":
+			return "bad client credentials"
+		case r.PostForm.Get("grant_type") != "client_credentials":
+			return "bad grant_type"
+		case r.PostForm.Get("scope") != "read write":
+			return "bad scope"
+		case r.PostForm.Get("audience") != "api":
+			return "bad audience"
+		}
+		return ""
+	})
+	apiServer := newAPIServer(t, "Bearer access-1")
+
+	ts := httpx.NewClientCredentialsSource(newTestClient(), httpx.OAuth2Config{
+		TokenURL:       tokenServer.URL,
+		ClientID:       "my-client",
+		ClientSecret:   "s3cr3t",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: map[string][]string{"audience": {"api"}},
+	})
+	client := newTestClient(httpx.WithBearerAuth(ts))
+
+	for i := 0; i < 2; i++ {
+		if resp, _ := doGet(t, client, apiServer.URL, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+	if n := atomic.LoadInt32(issued); n != 1 {
+		t.Errorf("expected token to be issued once, got %d", n)
+	}
+}
+
+func TestNewClientCredentialsSource_AuthInParams(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, func(r *http.Request) string {
+		if _, _, ok := r.BasicAuth(); ok {
+			return "unexpected basic auth"
+		}
+		if r.PostForm.Get("client_id") != "my-client" || r.PostForm.Get("client_secret") != "s3cr3t" {
+			return "bad client credentials"
+		}
+		return ""
+	})
+
+	ts := httpx.NewClientCredentialsSource(newTestClient(), httpx.OAuth2Config{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "my-client",
+		ClientSecret: "s3cr3t",
+		AuthInParams: true,
+	})
+
+	token, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "access-1" || token.TokenType != "Bearer" || token.Expiry.IsZero() {
+		t.Errorf("unexpected token: %+v", token)
+	}
+}
+
+func TestNewClientCredentialsSource_TokenEndpointRetries(t *testing.T) {
+	var calls int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":"60"}`))
+	}))
+	defer tokenServer.Close()
+
+	tokenClient := newTestClient(httpx.WithRetries(3), httpx.WithRetryDelay(time.Millisecond))
+	ts := httpx.NewClientCredentialsSource(tokenClient, httpx.OAuth2Config{TokenURL: tokenServer.URL, ClientID: "c"})
+
+	token, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("expected token client to retry, got %v", err)
+	}
+	if token.AccessToken != "access" || token.Expiry.IsZero() {
+		t.Errorf("unexpected token: %+v", token)
+	}
+}
+
+func TestNewClientCredentialsSource_Error(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, func(r *http.Request) string { return "client disabled" })
+
+	ts := httpx.NewClientCredentialsSource(newTestClient(), httpx.OAuth2Config{TokenURL: tokenServer.URL, ClientID: "c"})
+
+	_, err := ts.Token(context.Background())
+	var oauthErr *httpx.OAuth2Error
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("expected OAuth2Error, got %v", err)
+	}
+	if oauthErr.Code != "invalid_grant" || oauthErr.Description != "client disabled" || oauthErr.StatusCode != 400 {
+		t.Errorf("unexpected error: %+v", oauthErr)
+	}
+}
+
+func TestNewRefreshTokenSource_RotatesRefreshToken(t *testing.T) {
+	var refreshTokens []string
+	tokenServer, _ := newTokenServer(t, func(r *http.Request) string {
+		if r.PostForm.Get("grant_type") != "refresh_token" {
+			return "bad grant_type"
+		}
+		refreshTokens = append(refreshTokens, r.PostForm.Get("refresh_token"))
+		return ""
+	})
+
+	ts := httpx.NewRefreshTokenSource(newTestClient(), httpx.OAuth2Config{TokenURL: tokenServer.URL, ClientID: "c"}, "initial")
+
+	for i := 0; i < 2; i++ {
+		if _, err := ts.Token(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(refreshTokens) != 2 || refreshTokens[0] != "initial" || refreshTokens[1] != "refresh-1" {
+		t.Errorf("expected rotated refresh token to be used, got %q", refreshTokens)
+	}
+}
+
+func decodeJWT(t *testing.T, jwt string) (map[string]any, map[string]any, []byte) {
+	t.Helper()
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 JWT parts, got %d", len(parts))
+	}
+	var header, claims map[string]any
+	for i, target := range []*map[string]any{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("invalid JWT encoding: %v", err)
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			t.Fatalf("invalid JWT JSON: %v", err)
+		}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("invalid JWT signature encoding: %v", err)
+	}
+	return header, claims, signature
+}
+
+func TestNewJWTBearerSource_HS256(t *testing.T) {
+	secret := []byte("shared-secret")
+
+	tokenServer, _ := newTokenServer(t, func(r *http.Request) string {
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			return "bad grant_type"
+		}
+		assertion := r.PostForm.Get("assertion")
+		header, claims, signature := decodeJWT(t, assertion)
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(assertion[:strings.LastIndex(assertion, ".")]))
+		switch {
+		case !hmac.Equal(mac.Sum(nil), signature):
+			return "bad signature"
+		case header["alg"] != "HS256" || header["kid"] != "key-1":
+			return "bad header"
+		case claims["iss"] != "svc" || claims["sub"] != "user" || claims["aud"] != "https://idp" || claims["tenant"] != "t1":
+			return "bad claims"
+		}
+		return ""
+	})
+
+	ts := httpx.NewJWTBearerSource(newTestClient(), httpx.OAuth2Config{TokenURL: tokenServer.URL}, httpx.JWTAssertion{
+		Issuer:   "svc",
+		Subject:  "user",
+		Audience: "https://idp",
+		KeyID:    "key-1",
+		Key:      secret,
+		Claims:   map[string]any{"tenant": "t1"},
+	})
+
+	if _, err := ts.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewJWTBearerSource_ES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tokenServer, _ := newTokenServer(t, func(r *http.Request) string {
+		assertion := r.PostForm.Get("assertion")
+		header, _, signature := decodeJWT(t, assertion)
+
+		digest := sha256.Sum256([]byte(assertion[:strings.LastIndex(assertion, ".")]))
+		rs, ss := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if header["alg"] != "ES256" || !ecdsa.Verify(&key.PublicKey, digest[:], rs, ss) {
+			return "bad signature"
+		}
+		return ""
+	})
+
+	ts := httpx.NewJWTBearerSource(newTestClient(), httpx.OAuth2Config{TokenURL: tokenServer.URL}, httpx.JWTAssertion{
+		Issuer: "svc",
+		Key:    key,
+	})
+
+	if _, err := ts.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package httpx
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrCertificatePinMismatch is returned when no certificate presented by a
+// pinned host matches one of its pins. It is not retried.
+var ErrCertificatePinMismatch = errors.New("certificate pin mismatch")
+
+// PinningOption configures the pinning set up by WithPublicKeyPins.
+type PinningOption func(*publicKeyPinning)
+
+// PinReportOnly logs pin mismatches instead of failing the handshake, to
+// roll out new pins safely.
+func PinReportOnly() PinningOption {
+	return func(p *publicKeyPinning) { p.reportOnly = true }
+}
+
+// WithPublicKeyPins pins the public keys of the servers in pins, keyed by host
+// name. A pin is the base64 encoded SHA-256 of a certificate's
+// SubjectPublicKeyInfo, optionally prefixed with "sha256/" (see SPKIPin). The
+// handshake succeeds when any certificate of the verified chain matches any pin
+// of the host, so list backup pins for the next key next to the current one. Hosts
+// without pins are not checked.
+func WithPublicKeyPins(pins map[string][]string, opts ...PinningOption) ClientOption {
+	return func(c *client) {
+		p := &publicKeyPinning{logger: c.Logger, pins: make(map[string]map[string]bool, len(pins))}
+		for _, opt := range opts {
+			opt(p)
+		}
+
+		for host, hostPins := range pins {
+			set := make(map[string]bool, len(hostPins))
+			for _, pin := range hostPins {
+				set[strings.TrimPrefix(pin, "sha256/")] = true
+			}
+			if len(set) < 2 {
+				c.Logger.Warn("certificate pins have no backup pin", slog.String("host", host))
+			}
+			p.pins[strings.ToLower(host)] = set
+		}
+
+		cfg := c.tlsConfig()
+		verify := cfg.VerifyConnection
+		verifyHost := func(host string) func(tls.ConnectionState) error {
+			return func(cs tls.ConnectionState) error {
+				if verify != nil {
+					if err := verify(cs); err != nil {
+						return err
+					}
+				}
+				return p.verify(host, cs)
+			}
+		}
+
+		// Connections through a proxy are only checked by server name, which
+		// is empty for IP addresses
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyHost(cs.ServerName)(cs)
+		}
+
+		// Direct connections know the host they dial
+		transport := c.baseTransport()
+		transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			conf := transport.TLSClientConfig.Clone()
+			if conf.ServerName == "" {
+				conf.ServerName = host
+			}
+			conf.VerifyConnection = verifyHost(host)
+			return dialTLS(ctx, transport, network, addr, conf)
+		}
+	}
+}
+
+// dialTLS dials addr with the dialer of t and performs the TLS handshake
+func dialTLS(ctx context.Context, t *http.Transport, network, addr string, cfg *tls.Config) (net.Conn, error) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// SPKIPin returns the pin of cert for WithPublicKeyPins.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+type publicKeyPinning struct {
+	logger     *slog.Logger
+	pins       map[string]map[string]bool
+	reportOnly bool
+}
+
+func (p *publicKeyPinning) verify(host string, cs tls.ConnectionState) error {
+	pins, ok := p.pins[strings.ToLower(host)]
+	if !ok {
+		return nil
+	}
+
+	// Only verified chains are matched, including their root which may be
+	// pinned as well: the peer can send any certificate next to its own, such
+	// as the one of the pinned server. Without verification only the leaf
+	// certificate is matched.
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		certs = cs.PeerCertificates[:1]
+	}
+
+	var presented []string
+	seen := make(map[string]bool, len(certs))
+	for _, cert := range certs {
+		pin := strings.TrimPrefix(SPKIPin(cert), "sha256/")
+		if pins[pin] {
+			return nil
+		}
+		if !seen[pin] {
+			seen[pin] = true
+			presented = append(presented, pin)
+		}
+	}
+
+	if p.reportOnly {
+		p.logger.Warn("certificate pin mismatch",
+			slog.String("host", host),
+			slog.Any("presented_pins", presented),
+		)
+		return nil
+	}
+
+	p.logger.Error("certificate pin mismatch, rejecting connection",
+		slog.String("host", host),
+		slog.Any("presented_pins", presented),
+	)
+	return fmt.Errorf("%w for %s", ErrCertificatePinMismatch, host)
+}
@@ -0,0 +1,173 @@
+package httpx_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+const unrelatedPin = "sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func newPinnedServer(t *testing.T) (*httptest.Server, *x509.CertPool, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, roots, &requests
+}
+
+func TestWithPublicKeyPins(t *testing.T) {
+	server, roots, _ := newPinnedServer(t)
+	serverPin := httpx.SPKIPin(server.Certificate())
+
+	testCases := []struct {
+		name    string
+		pins    map[string][]string
+		wantErr bool
+	}{
+		{"matching pin", map[string][]string{"127.0.0.1": {serverPin, unrelatedPin}}, false},
+		{"matching backup pin", map[string][]string{"127.0.0.1": {unrelatedPin, serverPin}}, false},
+		{"pin without prefix", map[string][]string{"127.0.0.1": {strings.TrimPrefix(serverPin, "sha256/")}}, false},
+		{"mismatch", map[string][]string{"127.0.0.1": {unrelatedPin}}, true},
+		{"other host pinned", map[string][]string{"payments.example.com": {unrelatedPin}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestClient(httpx.WithRootCAs(roots), httpx.WithPublicKeyPins(tc.pins))
+
+			_, err := getBody(t, client, server.URL)
+			if tc.wantErr {
+				if !errors.Is(err, httpx.ErrCertificatePinMismatch) {
+					t.Fatalf("expected ErrCertificatePinMismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPublicKeyPins_MismatchIsNotRetried(t *testing.T) {
+	server, roots, requests := newPinnedServer(t)
+
+	client := newTestClient(
+		httpx.WithRetries(3),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithRootCAs(roots),
+		httpx.WithPublicKeyPins(map[string][]string{"127.0.0.1": {unrelatedPin}}),
+	)
+
+	start := time.Now()
+	if _, err := getBody(t, client, server.URL); !errors.Is(err, httpx.ErrCertificatePinMismatch) {
+		t.Fatalf("expected ErrCertificatePinMismatch, got %v", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected no request to reach the server, got %d", requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected no retries, took %s", elapsed)
+	}
+}
+
+func TestWithPublicKeyPins_ReportOnly(t *testing.T) {
+	server, roots, requests := newPinnedServer(t)
+
+	var logs bytes.Buffer
+	client := httpx.New(slog.New(slog.NewTextHandler(&logs, nil)),
+		httpx.WithRootCAs(roots),
+		httpx.WithPublicKeyPins(map[string][]string{"127.0.0.1": {unrelatedPin}}, httpx.PinReportOnly()),
+	)
+
+	if _, err := getBody(t, client, server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected request to reach the server, got %d", requests.Load())
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "certificate pin mismatch") {
+		t.Errorf("expected mismatch to be logged, got %s", output)
+	}
+	if !strings.Contains(output, strings.TrimPrefix(httpx.SPKIPin(server.Certificate()), "sha256/")) {
+		t.Errorf("expected presented pin to be logged, got %s", output)
+	}
+}
+
+func TestWithPublicKeyPins_WarnsWithoutBackupPin(t *testing.T) {
+	var logs bytes.Buffer
+	httpx.New(slog.New(slog.NewTextHandler(&logs, nil)),
+		httpx.WithPublicKeyPins(map[string][]string{"payments.example.com": {unrelatedPin}}),
+	)
+
+	if !strings.Contains(logs.String(), "certificate pins have no backup pin") {
+		t.Errorf("expected warning about missing backup pin, got %s", logs.String())
+	}
+}
+
+func TestWithPublicKeyPins_IgnoresUnverifiedCertificates(t *testing.T) {
+	// The server has a certificate from a trusted CA and appends the
+	// certificate of the pinned server to its chain
+	ca := newTestCA(t)
+	pinned := newTestCA(t).cert
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der, pinned.Raw}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := newTestClient(httpx.WithRootCAs(roots), httpx.WithPublicKeyPins(map[string][]string{
+		"127.0.0.1": {httpx.SPKIPin(pinned), unrelatedPin},
+	}))
+	if _, err := getBody(t, client, server.URL); !errors.Is(err, httpx.ErrCertificatePinMismatch) {
+		t.Fatalf("expected ErrCertificatePinMismatch for an unverified certificate, got %v", err)
+	}
+
+	client = newTestClient(httpx.WithRootCAs(roots), httpx.WithPublicKeyPins(map[string][]string{
+		"127.0.0.1": {httpx.SPKIPin(ca.cert), unrelatedPin},
+	}))
+	if _, err := getBody(t, client, server.URL); err != nil {
+		t.Fatalf("expected pinned root of the verified chain to match, got %v", err)
+	}
+}
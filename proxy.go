@@ -0,0 +1,110 @@
+package httpx
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// ProxyOption configures the routing set up by WithProxy.
+type ProxyOption func(*proxyRouter)
+
+// ProxyRoute sends requests to hosts matching pattern through proxyURL
+// instead of the default proxy. Routes are tried in the order they are added.
+// See WithProxy for the pattern syntax.
+func ProxyRoute(pattern string, proxyURL *url.URL) ProxyOption {
+	return func(r *proxyRouter) { r.routes = append(r.routes, proxyRoute{pattern: pattern, proxy: proxyURL}) }
+}
+
+// ProxyBypass connects directly to hosts matching any of patterns, whatever
+// routes and default proxy are configured.
+func ProxyBypass(patterns ...string) ProxyOption {
+	return func(r *proxyRouter) { r.bypass = append(r.bypass, patterns...) }
+}
+
+// WithProxy sends requests through proxyURL, replacing the proxy settings
+// from the environment. Supported schemes are "http" and "https", which use
+// CONNECT for https targets, and "socks5" or "socks5h", handled by the SOCKS5
+// client built into net/http. Credentials in the URL authenticate against the
+// proxy. proxyURL may be nil to only use ProxyRoute.
+//
+// Host patterns are "*" for every host, a CIDR such as "10.0.0.0/8" for IP
+// addresses, ".example.com" for subdomains only or "example.com" for the
+// domain and its subdomains. The proxy used for a request is logged at debug
+// level without its credentials.
+func WithProxy(proxyURL *url.URL, opts ...ProxyOption) ClientOption {
+	return func(c *client) {
+		r := &proxyRouter{logger: c.Logger, redactor: c.redactor, proxy: proxyURL}
+		for _, opt := range opts {
+			opt(r)
+		}
+		c.baseTransport().Proxy = r.proxyFor
+	}
+}
+
+type proxyRoute struct {
+	pattern string
+	proxy   *url.URL
+}
+
+type proxyRouter struct {
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	proxy    *url.URL
+	routes   []proxyRoute
+	bypass   []string
+}
+
+// proxyFor returns the proxy for req, nil for a direct connection
+func (r *proxyRouter) proxyFor(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+
+	for _, pattern := range r.bypass {
+		if matchHostPattern(pattern, host) {
+			return nil, nil
+		}
+	}
+
+	proxy := r.proxy
+	for _, route := range r.routes {
+		if matchHostPattern(route.pattern, host) {
+			proxy = route.proxy
+			break
+		}
+	}
+
+	if proxy != nil {
+		r.logger.DebugContext(req.Context(), "using proxy",
+			slog.String("method", req.Method),
+			slog.String("url", r.redactor.URL(req.URL)),
+			slog.String("proxy", r.redactor.URL(proxy)),
+		)
+	}
+	return proxy, nil
+}
+
+func matchHostPattern(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.ToLower(host)
+
+	switch {
+	case pattern == "*":
+		return true
+	case strings.Contains(pattern, "/"):
+		prefix, err := netip.ParsePrefix(pattern)
+		if err != nil {
+			return false
+		}
+		ip, err := netip.ParseAddr(host)
+		return err == nil && prefix.Contains(ip.Unmap())
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		return strings.HasSuffix(host, pattern)
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
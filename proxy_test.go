@@ -0,0 +1,349 @@
+package httpx_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// proxyLog records what an in-process proxy was asked to do
+type proxyLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *proxyLog) add(entry string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *proxyLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+// pipe copies between a and b until either side is done
+func pipe(a, b net.Conn) {
+	go func() {
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+	_, _ = io.Copy(b, a)
+	_ = b.Close()
+}
+
+// newHTTPProxy starts a forward proxy supporting CONNECT that requires the
+// given credentials unless user is empty
+func newHTTPProxy(t *testing.T, user, password string) (*url.URL, *proxyLog) {
+	t.Helper()
+
+	log := &proxyLog{}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user != "" && r.Header.Get("Proxy-Authorization") != wantAuth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method == http.MethodConnect {
+			log.add("CONNECT " + r.Host)
+			target, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				_ = target.Close()
+				return
+			}
+			_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+			pipe(conn, target)
+			return
+		}
+
+		log.add(r.Method + " " + r.URL.String())
+		outReq := r.Clone(r.Context())
+		outReq.RequestURI = ""
+		outReq.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(outReq)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(server.Close)
+
+	proxyURL, _ := url.Parse(server.URL)
+	if user != "" {
+		proxyURL.User = url.UserPassword(user, password)
+	}
+	return proxyURL, log
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy (RFC 1928) requiring username and
+// password authentication (RFC 1929) unless user is empty
+func newSOCKS5Proxy(t *testing.T, user, password string) (*url.URL, *proxyLog) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	log := &proxyLog{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, user, password, log)
+		}
+	}()
+
+	proxyURL := &url.URL{Scheme: "socks5", Host: listener.Addr().String()}
+	if user != "" {
+		proxyURL.User = url.UserPassword(user, password)
+	}
+	return proxyURL, log
+}
+
+func serveSOCKS5(conn net.Conn, user, password string, log *proxyLog) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 5 {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	if user == "" {
+		_, _ = conn.Write([]byte{5, 0})
+	} else {
+		if !bytes.Contains(methods, []byte{2}) {
+			_, _ = conn.Write([]byte{5, 0xff})
+			return
+		}
+		_, _ = conn.Write([]byte{5, 2})
+
+		readField := func() string {
+			size := make([]byte, 1)
+			_, _ = io.ReadFull(conn, size)
+			field := make([]byte, size[0])
+			_, _ = io.ReadFull(conn, field)
+			return string(field)
+		}
+		version := make([]byte, 1)
+		_, _ = io.ReadFull(conn, version)
+		if readField() != user || readField() != password {
+			_, _ = conn.Write([]byte{1, 1})
+			return
+		}
+		_, _ = conn.Write([]byte{1, 0})
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil || request[1] != 1 {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1, 4:
+		ip := make([]byte, map[byte]int{1: 4, 4: 16}[request[3]])
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		size := make([]byte, 1)
+		_, _ = io.ReadFull(conn, size)
+		name := make([]byte, size[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	_, _ = io.ReadFull(conn, port)
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	log.add("CONNECT " + target)
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	pipe(conn, upstream)
+}
+
+func newTargetServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "target")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithProxy_HTTP(t *testing.T) {
+	target := newTargetServer(t)
+	proxyURL, log := newHTTPProxy(t, "user", "secret")
+
+	client := newTestClient(httpx.WithProxy(proxyURL))
+
+	body, err := getBody(t, client, target.URL+"/path")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body != "target" {
+		t.Errorf("expected response from target, got %q", body)
+	}
+	if entries := log.get(); len(entries) != 1 || entries[0] != "GET "+target.URL+"/path" {
+		t.Errorf("expected request to go through the proxy, got %v", entries)
+	}
+}
+
+func TestWithProxy_CONNECT(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secure target")
+	}))
+	defer target.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(target.Certificate())
+
+	proxyURL, log := newHTTPProxy(t, "user", "secret")
+	client := newTestClient(httpx.WithRootCAs(roots), httpx.WithProxy(proxyURL))
+
+	body, err := getBody(t, client, target.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body != "secure target" {
+		t.Errorf("expected response from target, got %q", body)
+	}
+	if entries := log.get(); len(entries) != 1 || entries[0] != "CONNECT "+target.Listener.Addr().String() {
+		t.Errorf("expected CONNECT through the proxy, got %v", entries)
+	}
+}
+
+func TestWithProxy_SOCKS5(t *testing.T) {
+	target := newTargetServer(t)
+	proxyURL, log := newSOCKS5Proxy(t, "user", "secret")
+
+	t.Run("authenticated", func(t *testing.T) {
+		body, err := getBody(t, newTestClient(httpx.WithProxy(proxyURL)), target.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if body != "target" {
+			t.Errorf("expected response from target, got %q", body)
+		}
+		if entries := log.get(); len(entries) != 1 || entries[0] != "CONNECT "+target.Listener.Addr().String() {
+			t.Errorf("expected connection through the proxy, got %v", entries)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		wrong := *proxyURL
+		wrong.User = url.UserPassword("user", "wrong")
+		if _, err := getBody(t, newTestClient(httpx.WithProxy(&wrong)), target.URL); err == nil {
+			t.Fatal("expected authentication to fail")
+		}
+	})
+}
+
+func TestWithProxy_Routing(t *testing.T) {
+	target := newTargetServer(t)
+	// localhost keeps the target reachable while not matching IP patterns
+	targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	defaultProxy, defaultLog := newHTTPProxy(t, "", "")
+	routedProxy, routedLog := newHTTPProxy(t, "", "")
+
+	testCases := []struct {
+		name string
+		opts []httpx.ProxyOption
+		want string
+	}{
+		{"default proxy", nil, "default"},
+		{"route by domain", []httpx.ProxyOption{httpx.ProxyRoute("localhost", routedProxy)}, "routed"},
+		{"route by wildcard", []httpx.ProxyOption{httpx.ProxyRoute("*", routedProxy)}, "routed"},
+		{"route for subdomains only", []httpx.ProxyOption{httpx.ProxyRoute(".localhost", routedProxy)}, "default"},
+		{"route by CIDR", []httpx.ProxyOption{httpx.ProxyRoute("127.0.0.0/8", routedProxy)}, "default"},
+		{"first matching route", []httpx.ProxyOption{
+			httpx.ProxyRoute("example.com", defaultProxy),
+			httpx.ProxyRoute("localhost", routedProxy),
+		}, "routed"},
+		{"bypass", []httpx.ProxyOption{httpx.ProxyRoute("localhost", routedProxy), httpx.ProxyBypass("localhost")}, "direct"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaultBefore, routedBefore := len(defaultLog.get()), len(routedLog.get())
+
+			if _, err := getBody(t, newTestClient(httpx.WithProxy(defaultProxy, tc.opts...)), targetURL); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := "direct"
+			switch {
+			case len(defaultLog.get()) > defaultBefore:
+				got = "default"
+			case len(routedLog.get()) > routedBefore:
+				got = "routed"
+			}
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWithProxy_LogsProxyWithoutPassword(t *testing.T) {
+	target := newTargetServer(t)
+	proxyURL, _ := newHTTPProxy(t, "user", "secret")
+
+	var logs bytes.Buffer
+	client := httpx.New(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		httpx.WithProxy(proxyURL))
+
+	if _, err := getBody(t, client, target.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := logs.String()
+	want := fmt.Sprintf(`msg="using proxy" method=GET url=%s proxy=http://REDACTED@%s`, target.URL, proxyURL.Host)
+	if !strings.Contains(output, want) {
+		t.Errorf("expected log line containing %q, got:\n%s", want, output)
+	}
+	if strings.Contains(output, "secret") {
+		t.Errorf("expected proxy password to be redacted, got:\n%s", output)
+	}
+}
@@ -0,0 +1,201 @@
+package httpx
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+// rateLimitSweepInterval is how often idle token buckets are looked for
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitKeyFunc extracts the key a request is rate limited under.
+// Requests sharing a key share one token bucket.
+type RateLimitKeyFunc func(req *http.Request) string
+
+// RateLimitOption configures a rate limiter created by WithRateLimit.
+type RateLimitOption func(*rateLimitTransport)
+
+// RateLimitPerHost gives every request host its own token bucket.
+func RateLimitPerHost() RateLimitOption {
+	return RateLimitByKey(func(req *http.Request) string { return req.URL.Host })
+}
+
+// RateLimitByKey gives every key returned by fn its own token bucket, e.g. one
+// bucket per API key header.
+func RateLimitByKey(fn RateLimitKeyFunc) RateLimitOption {
+	return func(t *rateLimitTransport) { t.keyFunc = fn }
+}
+
+// WithRateLimit limits requests to rps per second with bursts of up to burst
+// requests. By default a single bucket is shared by every request made by the
+// client. The limit is applied to each attempt, so retries consume tokens too.
+// Do blocks until a token is available or the context is done. Buckets that
+// have refilled and are not in use are dropped, so keys seen once do not
+// accumulate.
+func WithRateLimit(rps float64, burst int, opts ...RateLimitOption) ClientOption {
+	return func(c *client) {
+		t := &rateLimitTransport{
+			logger:   c.Logger,
+			redactor: c.redactor,
+			rate:     rps,
+			burst:    burst,
+			limiters: make(map[string]*tokenBucket),
+		}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type rateLimitTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	rate     float64
+	burst    int
+	keyFunc  RateLimitKeyFunc
+
+	mu        sync.Mutex
+	limiters  map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	key := ""
+	if t.keyFunc != nil {
+		key = t.keyFunc(req)
+	}
+
+	bucket := t.bucket(key)
+	delay, err := bucket.wait(ctx)
+	t.release(bucket)
+	if delay > 0 {
+		t.logger.DebugContext(ctx, "rate limit delayed request",
+			slog.String("key", key),
+			slog.Duration("delay", delay),
+			slog.String("url", t.redactor.URL(req.URL)),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// bucket returns the token bucket for key, creating it on first use. The
+// bucket is kept until release is called.
+func (t *rateLimitTransport) bucket(key string) *tokenBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.limiters[key]
+	if !ok {
+		t.sweep()
+		b = newTokenBucket(t.rate, t.burst)
+		t.limiters[key] = b
+	}
+	b.users++
+	return b
+}
+
+func (t *rateLimitTransport) release(b *tokenBucket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b.users--
+}
+
+// sweep drops buckets that are full and not in use, which behave exactly like
+// new ones. It runs at most once per rateLimitSweepInterval.
+func (t *rateLimitTransport) sweep() {
+	now := time.Now()
+	if now.Sub(t.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	t.lastSweep = now
+
+	for key, b := range t.limiters {
+		if b.users == 0 && b.full(now) {
+			delete(t.limiters, key)
+		}
+	}
+}
+
+// tokenBucket is a token bucket refilled continuously at rate tokens per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// users is guarded by the mutex of the rateLimitTransport
+	users int
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// full reports whether the bucket has refilled completely by now
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// wait takes a token, blocking until one is available or ctx is done.
+// It returns how long the caller had to wait.
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	if b.rate <= 0 {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	// Reserve the token up front so concurrent callers queue behind each other
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+
+	if err := sleepContext(ctx, delay); err != nil {
+		// Give back the reserved token
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return delay, err
+	}
+	return delay, nil
+}
@@ -0,0 +1,156 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestWithRateLimit_Global(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRateLimit(20, 1))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	duration := time.Since(start)
+
+	// 1 burst token, then 3 tokens at 50ms each
+	if duration < 130*time.Millisecond {
+		t.Errorf("expected requests to be rate limited, completed in %v", duration)
+	}
+	if atomic.LoadInt32(&callCount) != 4 {
+		t.Errorf("expected 4 calls, got %d", callCount)
+	}
+}
+
+func TestWithRateLimit_RetriesConsumeTokens(t *testing.T) {
+	callCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(
+		httpx.WithRetries(3),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithRateLimit(10, 1),
+	)
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// 3 attempts at 10 req/s with a burst of 1 need at least ~200ms
+	if duration := time.Since(start); duration < 180*time.Millisecond {
+		t.Errorf("expected retries to wait for tokens, completed in %v", duration)
+	}
+}
+
+func TestWithRateLimit_PerHost(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server1 := httptest.NewServer(handler)
+	defer server1.Close()
+	server2 := httptest.NewServer(handler)
+	defer server2.Close()
+
+	client := newTestClient(httpx.WithRateLimit(1, 1, httpx.RateLimitPerHost()))
+
+	start := time.Now()
+	for _, url := range []string{server1.URL, server2.URL} {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if duration := time.Since(start); duration > 500*time.Millisecond {
+		t.Errorf("expected separate buckets per host, took %v", duration)
+	}
+}
+
+func TestWithRateLimit_ByKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRateLimit(1, 1, httpx.RateLimitByKey(func(req *http.Request) string {
+		return req.Header.Get("X-API-Key")
+	})))
+
+	start := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if duration := time.Since(start); duration > 500*time.Millisecond {
+		t.Errorf("expected separate buckets per key, took %v", duration)
+	}
+}
+
+func TestWithRateLimit_ContextExpires(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRateLimit(0.5, 1))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	_, err = client.Do(ctx, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if duration := time.Since(start); duration > time.Second {
+		t.Errorf("expected Do to stop waiting when the context expires, took %v", duration)
+	}
+}
@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+const defaultMaxRedirects = 10
+
+// ErrRedirectBlocked is returned when a redirect is refused by the redirect
+// policy. It is not retried.
+var ErrRedirectBlocked = errors.New("redirect blocked")
+
+// RedirectOption configures the policy set up by WithRedirectPolicy.
+type RedirectOption func(*redirectPolicy)
+
+// RedirectMaxHops sets how many redirects are followed (default: 10). Zero
+// refuses every redirect.
+func RedirectMaxHops(n int) RedirectOption {
+	return func(p *redirectPolicy) { p.maxHops = n }
+}
+
+// RedirectSameHostOnly refuses redirects to a host other than the one of the
+// original request.
+func RedirectSameHostOnly() RedirectOption {
+	return func(p *redirectPolicy) { p.sameHostOnly = true }
+}
+
+// RedirectAllowDowngrade follows redirects from https to http.
+func RedirectAllowDowngrade() RedirectOption {
+	return func(p *redirectPolicy) { p.allowDowngrade = true }
+}
+
+// WithRedirectPolicy restricts the redirects followed by the client. By
+// default at most 10 redirects are followed and redirects from https to http
+// are refused. Refused redirects fail with ErrRedirectBlocked. With or without
+// a policy, the Authorization header, including one added by a middleware, is
+// not sent to other origins than the one of the original request.
+func WithRedirectPolicy(opts ...RedirectOption) ClientOption {
+	return func(c *client) {
+		c.redirects = &redirectPolicy{maxHops: defaultMaxRedirects}
+		for _, opt := range opts {
+			opt(c.redirects)
+		}
+	}
+}
+
+// redirectPolicy decides which redirects are followed and logs every hop.
+// Without WithRedirectPolicy it behaves like the default of http.Client.
+type redirectPolicy struct {
+	logger         *slog.Logger
+	redactor       *logger.Redactor
+	maxHops        int
+	sameHostOnly   bool
+	allowDowngrade bool
+}
+
+func defaultRedirectPolicy() *redirectPolicy {
+	return &redirectPolicy{maxHops: defaultMaxRedirects, allowDowngrade: true}
+}
+
+func (p *redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	first, prev := via[0], via[len(via)-1]
+
+	status := 0
+	if req.Response != nil {
+		status = req.Response.StatusCode
+	}
+
+	var reason string
+	switch {
+	case len(via) > p.maxHops:
+		reason = fmt.Sprintf("stopped after %d redirects", p.maxHops)
+	case p.sameHostOnly && !strings.EqualFold(req.URL.Hostname(), first.URL.Hostname()):
+		reason = "redirect to another host"
+	case !p.allowDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme != "https":
+		reason = "redirect from https to http"
+	}
+
+	if reason != "" {
+		p.logger.WarnContext(req.Context(), "redirect blocked",
+			slog.String("url", p.redactor.URL(prev.URL)),
+			slog.Int("status", status),
+			slog.String("location", p.redactor.URL(req.URL)),
+			slog.String("reason", reason),
+		)
+		return fmt.Errorf("%w: %s", ErrRedirectBlocked, reason)
+	}
+
+	p.logger.InfoContext(req.Context(), "following redirect",
+		slog.Int("hop", len(via)),
+		slog.String("url", p.redactor.URL(prev.URL)),
+		slog.Int("status", status),
+		slog.String("location", p.redactor.URL(req.URL)),
+	)
+	return nil
+}
+
+// redirectAuthTransport removes the Authorization header from redirects to
+// another origin. It sits below the middlewares, which may have added it, and
+// also covers headers that http.Client keeps for subdomains or other ports.
+type redirectAuthTransport struct {
+	next http.RoundTripper
+}
+
+func (t *redirectAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" && isCrossOriginRedirect(req) {
+		req = req.Clone(req.Context())
+		req.Header.Del("Authorization")
+	}
+	return t.next.RoundTrip(req)
+}
+
+// isCrossOriginRedirect reports whether req follows a redirect to another
+// origin than the one of the original request. Middlewares adding credentials
+// skip such requests.
+func isCrossOriginRedirect(req *http.Request) bool {
+	if req.Response == nil {
+		return false
+	}
+
+	// Walk back the redirect chain to the original request
+	first := req
+	for first.Response != nil && first.Response.Request != nil {
+		first = first.Response.Request
+	}
+	return !sameOrigin(first.URL, req.URL)
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Hostname(), b.Hostname()) && originPort(a) == originPort(b)
+}
+
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
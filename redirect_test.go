@@ -0,0 +1,183 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestRedirects_LogEveryHop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	client := httpx.New(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if _, err := getBody(t, client, server.URL+"/a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{
+		`msg="following redirect" hop=1 url=` + server.URL + `/a status=301 location=` + server.URL + `/b`,
+		`msg="following redirect" hop=2 url=` + server.URL + `/b status=302 location=` + server.URL + `/c`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected log line containing %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestWithRedirectPolicy_MaxHops(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRetries(3), httpx.WithRedirectPolicy(httpx.RedirectMaxHops(2)))
+
+	if _, err := getBody(t, client, server.URL); !errors.Is(err, httpx.ErrRedirectBlocked) {
+		t.Fatalf("expected ErrRedirectBlocked, got %v", err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("expected original request and 2 redirects without retries, got %d requests", requests.Load())
+	}
+}
+
+func TestWithRedirectPolicy_SameHostOnly(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-host":
+			// Another port on the same host is still the same host
+			http.Redirect(w, r, target.URL, http.StatusFound)
+		case "/other-host":
+			http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithRedirectPolicy(httpx.RedirectSameHostOnly()))
+
+	if _, err := getBody(t, client, server.URL+"/same-host"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := getBody(t, client, server.URL+"/other-host"); !errors.Is(err, httpx.ErrRedirectBlocked) {
+		t.Fatalf("expected ErrRedirectBlocked, got %v", err)
+	}
+}
+
+func TestWithRedirectPolicy_Downgrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL, http.StatusFound)
+	}))
+	defer secure.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(secure.Certificate())
+
+	t.Run("refused by default", func(t *testing.T) {
+		client := newTestClient(httpx.WithRootCAs(roots), httpx.WithRedirectPolicy())
+		if _, err := getBody(t, client, secure.URL); !errors.Is(err, httpx.ErrRedirectBlocked) {
+			t.Fatalf("expected ErrRedirectBlocked, got %v", err)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		client := newTestClient(httpx.WithRootCAs(roots), httpx.WithRedirectPolicy(httpx.RedirectAllowDowngrade()))
+		if _, err := getBody(t, client, secure.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestWithRedirectPolicy_Authorization(t *testing.T) {
+	var otherOriginAuth atomic.Value
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherOriginAuth.Store(r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+
+	var sameOriginAuth atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-origin":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/target":
+			sameOriginAuth.Store(r.Header.Get("Authorization"))
+		case "/other-origin":
+			// Another port of the same host, for which http.Client keeps headers
+			http.Redirect(w, r, other.URL, http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	tokens := httpx.TokenSourceFunc(func(context.Context) (*httpx.Token, error) {
+		return &httpx.Token{AccessToken: "secret"}, nil
+	})
+
+	testCases := []struct {
+		name   string
+		opts   []httpx.ClientOption
+		header string
+	}{
+		// The policy must also apply to headers added by middlewares configured after it
+		{"middleware with policy", []httpx.ClientOption{httpx.WithRedirectPolicy(), httpx.WithBearerAuth(tokens)}, ""},
+		{"middleware without policy", []httpx.ClientOption{httpx.WithBearerAuth(tokens)}, ""},
+		{"set on the request", nil, "Bearer secret"},
+	}
+
+	get := func(t *testing.T, client httpx.Client, url, authorization string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sameOriginAuth.Store("")
+			otherOriginAuth.Store("")
+			client := newTestClient(tc.opts...)
+
+			get(t, client, server.URL+"/same-origin", tc.header)
+			if got := sameOriginAuth.Load(); got != "Bearer secret" {
+				t.Errorf("expected Authorization on same origin, got %q", got)
+			}
+
+			get(t, client, server.URL+"/other-origin", tc.header)
+			if got := otherOriginAuth.Load(); got != "" {
+				t.Errorf("expected no Authorization on other origin, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSignatureLabel = "sig1"
+
+// ErrSignatureInvalid is returned by VerifyMessageSignature when a request is
+// not signed, the signature does not match or it has expired.
+var ErrSignatureInvalid = errors.New("invalid message signature")
+
+// SignatureOption configures the middleware created by WithMessageSignature.
+type SignatureOption func(*signatureTransport)
+
+// SignatureComponents sets the covered components, e.g. "@method",
+// "@target-uri", "@authority", "@path", "@query" or lower-case header names
+// (default: "@method", "@target-uri", "content-digest"). The content-digest
+// component is computed from the request body when the header is missing and
+// skipped for requests without a body.
+func SignatureComponents(components ...string) SignatureOption {
+	return func(t *signatureTransport) { t.components = components }
+}
+
+// SignatureLabel sets the label of the signature (default: "sig1").
+func SignatureLabel(label string) SignatureOption {
+	return func(t *signatureTransport) { t.label = label }
+}
+
+// SignatureExpiry adds an expires parameter d after the creation time.
+func SignatureExpiry(d time.Duration) SignatureOption {
+	return func(t *signatureTransport) { t.expiry = d }
+}
+
+// SignatureTag adds a tag parameter identifying the application of the signature.
+func SignatureTag(tag string) SignatureOption {
+	return func(t *signatureTransport) { t.tag = tag }
+}
+
+// WithMessageSignature signs every attempt following RFC 9421 by adding
+// Signature-Input and Signature headers. key selects the algorithm: []byte for
+// hmac-sha256, ed25519.PrivateKey for ed25519 or *ecdsa.PrivateKey on P-256
+// for ecdsa-p256-sha256. Each retry is signed again so created stays fresh.
+func WithMessageSignature(keyID string, key any, opts ...SignatureOption) ClientOption {
+	return func(c *client) {
+		t := &signatureTransport{
+			keyID:      keyID,
+			key:        key,
+			label:      defaultSignatureLabel,
+			components: []string{"@method", "@target-uri", "content-digest"},
+		}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type signatureTransport struct {
+	next       http.RoundTripper
+	keyID      string
+	key        any
+	label      string
+	components []string
+	expiry     time.Duration
+	tag        string
+}
+
+func (t *signatureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	alg, err := signatureAlgorithm(t.key)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := req.Clone(req.Context())
+	hasBody := req.Body != nil && req.Body != http.NoBody
+
+	components := make([]string, 0, len(t.components))
+	for _, component := range t.components {
+		if component == "content-digest" {
+			if !hasBody {
+				continue
+			}
+			if signed.Header.Get("Content-Digest") == "" {
+				body, err := bufferRequestBody(signed)
+				if err != nil {
+					return nil, err
+				}
+				signed.Header.Set("Content-Digest", contentDigest(defaultDigestAlgorithm, body))
+			}
+		}
+		components = append(components, component)
+	}
+
+	created := time.Now()
+	params := serializeSignatureParams(components, created, t.expiry, t.keyID, alg, t.tag)
+
+	base, err := signatureBase(signed, components, params)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signMessage(t.key, []byte(base))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	signed.Header.Set("Signature-Input", t.label+"="+params)
+	signed.Header.Set("Signature", t.label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+
+	return t.next.RoundTrip(signed)
+}
+
+// VerifyMessageSignature verifies the first signature of req against key:
+// []byte for hmac-sha256, ed25519.PublicKey or *ecdsa.PublicKey. It works on
+// both outgoing requests and requests received by a server.
+func VerifyMessageSignature(req *http.Request, key any) error {
+	label, params, ok := strings.Cut(req.Header.Get("Signature-Input"), "=")
+	if !ok {
+		return fmt.Errorf("%w: missing Signature-Input", ErrSignatureInvalid)
+	}
+	label = strings.TrimSpace(label)
+	params = firstListMember(strings.TrimSpace(params))
+
+	signature, err := findSignature(req.Header.Get("Signature"), label)
+	if err != nil {
+		return err
+	}
+
+	components, paramValues, err := parseSignatureParams(params)
+	if err != nil {
+		return err
+	}
+	if expires, ok := paramValues["expires"]; ok {
+		secs, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > secs {
+			return fmt.Errorf("%w: signature expired", ErrSignatureInvalid)
+		}
+	}
+
+	base, err := signatureBase(req, components, params)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if !verifyMessage(key, []byte(base), signature) {
+		return fmt.Errorf("%w: signature mismatch", ErrSignatureInvalid)
+	}
+	return nil
+}
+
+func signatureAlgorithm(key any) (string, error) {
+	switch key.(type) {
+	case []byte:
+		return "hmac-sha256", nil
+	case ed25519.PrivateKey:
+		return "ed25519", nil
+	case *ecdsa.PrivateKey:
+		return "ecdsa-p256-sha256", nil
+	}
+	return "", fmt.Errorf("unsupported signature key type %T", key)
+}
+
+func signMessage(key any, base []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, base), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(base)
+		return signECDSAP256(k, digest[:])
+	}
+	return nil, fmt.Errorf("unsupported signature key type %T", key)
+}
+
+func verifyMessage(key any, base, signature []byte) bool {
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, base, signature)
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(base)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	}
+	return false
+}
+
+// serializeSignatureParams builds the inner list used both as the
+// Signature-Input value and the @signature-params line (RFC 9421 §2.3)
+func serializeSignatureParams(components []string, created time.Time, expiry time.Duration, keyID, alg, tag string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, component := range components {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Quote(component))
+	}
+	b.WriteByte(')')
+
+	b.WriteString(";created=" + strconv.FormatInt(created.Unix(), 10))
+	if expiry > 0 {
+		b.WriteString(";expires=" + strconv.FormatInt(created.Add(expiry).Unix(), 10))
+	}
+	if keyID != "" {
+		b.WriteString(";keyid=" + strconv.Quote(keyID))
+	}
+	b.WriteString(";alg=" + strconv.Quote(alg))
+	if tag != "" {
+		b.WriteString(";tag=" + strconv.Quote(tag))
+	}
+	return b.String()
+}
+
+// parseSignatureParams parses an inner list such as
+// ("@method" "@target-uri");created=1;keyid="k"
+func parseSignatureParams(params string) ([]string, map[string]string, error) {
+	if !strings.HasPrefix(params, "(") {
+		return nil, nil, fmt.Errorf("%w: malformed Signature-Input", ErrSignatureInvalid)
+	}
+	end := strings.IndexByte(params, ')')
+	if end < 0 {
+		return nil, nil, fmt.Errorf("%w: malformed Signature-Input", ErrSignatureInvalid)
+	}
+
+	var components []string
+	for _, item := range strings.Fields(params[1:end]) {
+		component, err := strconv.Unquote(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: malformed component %s", ErrSignatureInvalid, item)
+		}
+		components = append(components, component)
+	}
+
+	values := make(map[string]string)
+	for _, param := range strings.Split(params[end+1:], ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		values[name] = value
+	}
+	return components, values, nil
+}
+
+// firstListMember cuts a structured field list after its first member
+func firstListMember(list string) string {
+	inString := false
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\\':
+			i++
+		case '"':
+			inString = !inString
+		case ',':
+			if !inString {
+				return strings.TrimSpace(list[:i])
+			}
+		}
+	}
+	return list
+}
+
+// findSignature returns the decoded signature for label from a Signature header
+func findSignature(header, label string) ([]byte, error) {
+	for _, member := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok || name != label {
+			continue
+		}
+		value = strings.Trim(value, ":")
+		signature, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed Signature", ErrSignatureInvalid)
+		}
+		return signature, nil
+	}
+	return nil, fmt.Errorf("%w: missing Signature for %s", ErrSignatureInvalid, label)
+}
+
+// signatureBase builds the signature base (RFC 9421 §2.5)
+func signatureBase(req *http.Request, components []string, params string) (string, error) {
+	var b strings.Builder
+	for _, component := range components {
+		value, err := componentValue(req, component)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(component) + ": " + value + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return b.String(), nil
+}
+
+// componentValue returns the value of a derived component or header field (RFC 9421 §2.1, §2.2)
+func componentValue(req *http.Request, component string) (string, error) {
+	scheme, authority := requestOrigin(req)
+
+	switch component {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		return scheme + "://" + authority + req.URL.RequestURI(), nil
+	case "@authority":
+		return authority, nil
+	case "@scheme":
+		return scheme, nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if req.URL.EscapedPath() == "" {
+			return "/", nil
+		}
+		return req.URL.EscapedPath(), nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("unsupported derived component %s", component)
+	}
+
+	values := req.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("covered header %s is missing", component)
+	}
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// requestOrigin returns the scheme and lower-case authority of req, which
+// for server requests come from the Host header and the TLS state
+func requestOrigin(req *http.Request) (string, string) {
+	scheme := req.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	authority := req.URL.Host
+	if req.Host != "" {
+		authority = req.Host
+	}
+	return strings.ToLower(scheme), strings.ToLower(authority)
+}
+
+// bufferRequestBody reads the body of req, leaving it readable for the next
+// transport. It uses GetBody when Do already buffered the body for retries.
+func bufferRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
@@ -0,0 +1,194 @@
+package httpx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// newVerifyingServer verifies every request with key and records the outcome
+func newVerifyingServer(t *testing.T, key any, status func(attempt int) int) (*httptest.Server, *[]error, *[]*http.Request) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var results []error
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, httpx.VerifyMessageSignature(r, key))
+		requests = append(requests, r)
+		w.WriteHeader(status(len(results)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &results, &requests
+}
+
+func alwaysOK(int) int { return http.StatusOK }
+
+func TestWithMessageSignature_Algorithms(t *testing.T) {
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	ecPrivate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("shared-secret")
+
+	testCases := []struct {
+		name       string
+		signingKey any
+		verifyKey  any
+		alg        string
+	}{
+		{"hmac-sha256", secret, secret, "hmac-sha256"},
+		{"ed25519", edPrivate, edPublic, "ed25519"},
+		{"ecdsa-p256-sha256", ecPrivate, &ecPrivate.PublicKey, "ecdsa-p256-sha256"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, results, requests := newVerifyingServer(t, tc.verifyKey, alwaysOK)
+			client := newTestClient(httpx.WithMessageSignature("key-1", tc.signingKey))
+
+			req, _ := http.NewRequest("POST", server.URL+"/orders?id=1", strings.NewReader(`{"amount":10}`))
+			resp, err := client.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if err := (*results)[0]; err != nil {
+				t.Errorf("expected valid signature, got %v", err)
+			}
+			input := (*requests)[0].Header.Get("Signature-Input")
+			for _, want := range []string{`"@method" "@target-uri" "content-digest"`, `keyid="key-1"`, `alg="` + tc.alg + `"`} {
+				if !strings.Contains(input, want) {
+					t.Errorf("expected Signature-Input to contain %s, got %s", want, input)
+				}
+			}
+			if (*requests)[0].Header.Get("Content-Digest") == "" {
+				t.Error("expected Content-Digest to be added for the body")
+			}
+		})
+	}
+}
+
+func TestWithMessageSignature_ResignsEachRetry(t *testing.T) {
+	secret := []byte("shared-secret")
+	server, results, requests := newVerifyingServer(t, secret, func(attempt int) int {
+		if attempt == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	client := newTestClient(
+		httpx.WithRetries(2),
+		httpx.WithRetryDelay(1100*time.Millisecond),
+		httpx.WithMessageSignature("key-1", secret),
+	)
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("body"))
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(*results) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(*results))
+	}
+	for i, err := range *results {
+		if err != nil {
+			t.Errorf("attempt %d: expected valid signature, got %v", i+1, err)
+		}
+	}
+	first := (*requests)[0].Header.Get("Signature-Input")
+	second := (*requests)[1].Header.Get("Signature-Input")
+	if first == second {
+		t.Errorf("expected retry to be signed with a new created timestamp, both were %s", first)
+	}
+}
+
+func TestWithMessageSignature_CoveredHeaders(t *testing.T) {
+	secret := []byte("shared-secret")
+	server, results, requests := newVerifyingServer(t, secret, alwaysOK)
+
+	client := newTestClient(httpx.WithMessageSignature("key-1", secret,
+		httpx.SignatureComponents("@method", "@authority", "@path", "@query", "x-request-id"),
+		httpx.SignatureLabel("partner"),
+		httpx.SignatureExpiry(time.Minute),
+		httpx.SignatureTag("orders-api"),
+	))
+
+	req, _ := http.NewRequest("GET", server.URL+"/a?b=c", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := (*results)[0]; err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	input := (*requests)[0].Header.Get("Signature-Input")
+	for _, want := range []string{"partner=", `"x-request-id"`, ";expires=", `tag="orders-api"`} {
+		if !strings.Contains(input, want) {
+			t.Errorf("expected Signature-Input to contain %s, got %s", want, input)
+		}
+	}
+}
+
+func TestWithMessageSignature_MissingCoveredHeader(t *testing.T) {
+	server, _, _ := newVerifyingServer(t, []byte("k"), alwaysOK)
+	client := newTestClient(httpx.WithMessageSignature("key-1", []byte("k"), httpx.SignatureComponents("x-missing")))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Error("expected error for a missing covered header")
+	}
+}
+
+func TestVerifyMessageSignature_Tampered(t *testing.T) {
+	secret := []byte("shared-secret")
+	server, results, _ := newVerifyingServer(t, []byte("other-secret"), alwaysOK)
+	client := newTestClient(httpx.WithMessageSignature("key-1", secret))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if !errors.Is((*results)[0], httpx.ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid, got %v", (*results)[0])
+	}
+}
+
+// TestVerifyMessageSignature_RFC9421 checks the signature base against the
+// HMAC-SHA256 example of RFC 9421 Appendix B.2.5
+func TestVerifyMessageSignature_RFC9421(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+
+	req, _ := http.NewRequest("POST", "https://example.com/foo?param=Value&Pet=dog", io.NopCloser(strings.NewReader(`{"hello": "world"}`)))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+	req.Header.Set("Signature", `sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`)
+
+	if err := httpx.VerifyMessageSignature(req, key); err != nil {
+		t.Errorf("expected RFC 9421 example to verify, got %v", err)
+	}
+}
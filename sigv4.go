@@ -0,0 +1,379 @@
+package httpx
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+	sigV4MaxPresignAge   = 7 * 24 * time.Hour
+)
+
+// sigV4IgnoredHeaders are never signed because proxies and the transport may
+// change them
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"connection":        true,
+	"transfer-encoding": true,
+}
+
+// AWSCredentials are the credentials used to sign requests with SigV4.
+// SessionToken is only set for temporary credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Credentials returns c, so static credentials can be used as a provider.
+func (c AWSCredentials) Credentials(context.Context) (AWSCredentials, error) {
+	return c, nil
+}
+
+// AWSCredentialsProvider supplies the credentials for every signature, which
+// lets temporary credentials rotate without recreating the client.
+type AWSCredentialsProvider interface {
+	Credentials(ctx context.Context) (AWSCredentials, error)
+}
+
+// AWSCredentialsFunc adapts a function to an AWSCredentialsProvider.
+type AWSCredentialsFunc func(ctx context.Context) (AWSCredentials, error)
+
+func (f AWSCredentialsFunc) Credentials(ctx context.Context) (AWSCredentials, error) {
+	return f(ctx)
+}
+
+// SigV4Option configures a SigV4Signer.
+type SigV4Option func(*SigV4Signer)
+
+// SigV4UnsignedPayload signs requests with UNSIGNED-PAYLOAD instead of hashing
+// the body, which S3 accepts for large uploads over TLS.
+func SigV4UnsignedPayload() SigV4Option {
+	return func(s *SigV4Signer) { s.unsignedPayload = true }
+}
+
+// SigV4QueryAuth makes WithSigV4 authenticate requests with presigned URLs
+// valid for expires instead of the Authorization header.
+func SigV4QueryAuth(expires time.Duration) SigV4Option {
+	return func(s *SigV4Signer) { s.queryAuthExpiry = expires }
+}
+
+// SigV4Signer signs requests with AWS Signature Version 4.
+type SigV4Signer struct {
+	credentials     AWSCredentialsProvider
+	region          string
+	service         string
+	unsignedPayload bool
+	queryAuthExpiry time.Duration
+}
+
+// NewSigV4Signer returns a signer for service in region, e.g. "s3" in
+// "eu-west-1". For "s3" the path is neither normalized nor double-encoded and
+// the X-Amz-Content-Sha256 header is sent, as S3 requires.
+func NewSigV4Signer(credentials AWSCredentialsProvider, region, service string, opts ...SigV4Option) *SigV4Signer {
+	s := &SigV4Signer{credentials: credentials, region: region, service: service}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithSigV4 signs every attempt with s, so retries get a fresh X-Amz-Date.
+// Redirects to another origin are not signed, so the session token is not
+// sent there.
+func WithSigV4(s *SigV4Signer) ClientOption {
+	return func(c *client) {
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			return &sigV4Transport{next: next, signer: s}
+		})
+	}
+}
+
+type sigV4Transport struct {
+	next   http.RoundTripper
+	signer *SigV4Signer
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isCrossOriginRedirect(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	signed := req.Clone(req.Context())
+	now := time.Now()
+
+	if t.signer.queryAuthExpiry > 0 {
+		presigned, err := t.signer.Presign(signed, t.signer.queryAuthExpiry, now)
+		if err != nil {
+			return nil, err
+		}
+		if signed.URL, err = url.Parse(presigned); err != nil {
+			return nil, err
+		}
+	} else if err := t.signer.Sign(signed, now); err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(signed)
+}
+
+// Sign adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers to
+// req for a signature created at now. A previous signature is replaced.
+func (s *SigV4Signer) Sign(req *http.Request, now time.Time) error {
+	creds, err := s.credentials.Credentials(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to obtain aws credentials: %w", err)
+	}
+
+	now = now.UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		if payloadHash, err = s.payloadHash(req); err != nil {
+			return err
+		}
+		if s.service == "s3" || s.unsignedPayload {
+			req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		}
+	}
+
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+	scope := s.scope(now)
+	signature := s.signature(creds, now, scope, s.canonicalRequest(req, req.URL.Query(), canonicalHeaders, signedHeaders, payloadHash))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// Presign returns the URL of req with the signature in its query string, valid
+// for expires (at most 7 days) after now. Headers set on req are signed and
+// must be sent along with the URL.
+func (s *SigV4Signer) Presign(req *http.Request, expires time.Duration, now time.Time) (string, error) {
+	if expires <= 0 || expires > sigV4MaxPresignAge {
+		return "", fmt.Errorf("presigned url expiry must be between 1s and %s", sigV4MaxPresignAge)
+	}
+
+	creds, err := s.credentials.Credentials(req.Context())
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain aws credentials: %w", err)
+	}
+
+	now = now.UTC()
+	scope := s.scope(now)
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+
+	query := req.URL.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "X-Amz-") {
+			query.Del(key)
+		}
+	}
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Whoever uses the URL sends the body, so it cannot be hashed up front
+	payloadHash := sigV4UnsignedPayload
+	if !s.unsignedPayload && s.service != "s3" {
+		if payloadHash, err = s.payloadHash(req); err != nil {
+			return "", err
+		}
+	}
+
+	signature := s.signature(creds, now, scope, s.canonicalRequest(req, query, canonicalHeaders, signedHeaders, payloadHash))
+
+	presigned := *req.URL
+	presigned.RawQuery = sigV4CanonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return presigned.String(), nil
+}
+
+func (s *SigV4Signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// payloadHash returns the hex encoded SHA-256 of the body, reusing the body
+// buffered for retries
+func (s *SigV4Signer) payloadHash(req *http.Request) (string, error) {
+	if s.unsignedPayload {
+		return sigV4UnsignedPayload, nil
+	}
+	body, err := bufferRequestBody(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *SigV4Signer) canonicalRequest(req *http.Request, query url.Values, canonicalHeaders, signedHeaders, payloadHash string) string {
+	return strings.Join([]string{
+		req.Method,
+		s.canonicalPath(req.URL),
+		sigV4CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalPath encodes the path once for S3 and normalizes and encodes the
+// already escaped path again for every other service
+func (s *SigV4Signer) canonicalPath(u *url.URL) string {
+	if s.service == "s3" {
+		if u.Path == "" {
+			return "/"
+		}
+		return sigV4Escape(u.Path, false)
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return sigV4Escape(cleaned, false)
+}
+
+func (s *SigV4Signer) signature(creds AWSCredentials, now time.Time, scope, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sigV4Headers returns the signed header list and the canonical headers of
+// req, always including host
+func sigV4Headers(req *http.Request) (string, string) {
+	values := map[string][]string{"host": {sigV4Host(req)}}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if sigV4IgnoredHeaders[name] || name == "host" {
+			continue
+		}
+		values[name] = append(values[name], vals...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		canonical.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// sigV4Host returns the host of req without the default port of its scheme
+func sigV4Host(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if h, port, ok := strings.Cut(host, ":"); ok && !strings.Contains(port, ":") {
+		if port == "80" && req.URL.Scheme == "http" || port == "443" && req.URL.Scheme == "https" {
+			return h
+		}
+	}
+	return host
+}
+
+// sigV4CanonicalQuery encodes query sorted by key and value
+func sigV4CanonicalQuery(query url.Values) string {
+	type pair struct{ key, value string }
+
+	pairs := make([]pair, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{sigV4Escape(key, true), sigV4Escape(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.key + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+// sigV4Escape percent-encodes everything but unreserved characters, and the
+// slash unless encodeSlash is set
+func sigV4Escape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
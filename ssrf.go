@@ -0,0 +1,159 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrDestinationBlocked is returned when a connection to a disallowed
+// address is refused by WithDestinationGuard. It is not retried.
+var ErrDestinationBlocked = errors.New("destination blocked")
+
+// blockedPrefixes are refused by default on top of loopback, link-local,
+// private, unspecified and multicast addresses: IANA special-purpose ranges
+// that are not globally reachable, and IPv6 ranges embedding an IPv4 address,
+// which may be an internal one
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("169.254.169.254/32"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("fd00:ec2::254/128"),
+}
+
+// DestinationOption configures the guard set up by WithDestinationGuard.
+type DestinationOption func(*destinationGuard)
+
+// DestinationDeny blocks connections to prefixes in addition to the defaults.
+func DestinationDeny(prefixes ...netip.Prefix) DestinationOption {
+	return func(g *destinationGuard) { g.deny = append(g.deny, prefixes...) }
+}
+
+// DestinationAllow permits connections to prefixes even if they are blocked
+// by default or by DestinationDeny, e.g. a known internal service.
+func DestinationAllow(prefixes ...netip.Prefix) DestinationOption {
+	return func(g *destinationGuard) { g.allow = append(g.allow, prefixes...) }
+}
+
+// WithDestinationGuard protects against server-side request forgery when
+// sending requests to user-supplied URLs. Every connection is checked right
+// before it is made, against the resolved address actually dialed, so
+// redirects, retries and DNS rebinding cannot reach loopback, link-local,
+// private (RFC 1918 and unique local), CGNAT, unspecified, multicast or other
+// special-purpose addresses, IPv6 addresses embedding IPv4 ones (NAT64, 6to4,
+// Teredo) or the cloud metadata endpoint. Blocked connections fail with
+// ErrDestinationBlocked.
+//
+// Requests sent through a proxy, whether configured with WithProxy or taken
+// from the environment, are checked twice: the proxy address when dialing
+// it, and every address the destination host resolves to before the request
+// is handed to the proxy. A host that cannot be resolved is blocked. The proxy
+// resolves the host again, so it must be trusted not to follow DNS rebinding.
+func WithDestinationGuard(opts ...DestinationOption) ClientOption {
+	return func(c *client) {
+		g := &destinationGuard{logger: c.Logger}
+		for _, opt := range opts {
+			opt(g)
+		}
+
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   g.control,
+		}
+		c.baseTransport().DialContext = dialer.DialContext
+		c.destinationGuard = g
+	}
+}
+
+type destinationGuard struct {
+	logger *slog.Logger
+	allow  []netip.Prefix
+	deny   []netip.Prefix
+}
+
+// control runs after name resolution and before each connect
+func (g *destinationGuard) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: unparsable address %s", ErrDestinationBlocked, address)
+	}
+
+	if ip := addrPort.Addr().Unmap(); g.blocked(ip) {
+		g.logger.Warn("blocked connection to disallowed destination",
+			slog.String("network", network),
+			slog.String("address", address),
+		)
+		return fmt.Errorf("%w: %s", ErrDestinationBlocked, ip)
+	}
+	return nil
+}
+
+// proxy wraps the proxy selection of the transport to check the destination
+// of proxied requests, since only the proxy address is dialed for them
+func (g *destinationGuard) proxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	if next == nil {
+		return nil
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := next(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+
+		host := req.URL.Hostname()
+		addrs, err := net.DefaultResolver.LookupNetIP(req.Context(), "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot resolve %s: %w", ErrDestinationBlocked, host, err)
+		}
+		for _, addr := range addrs {
+			if ip := addr.Unmap(); g.blocked(ip) {
+				g.logger.WarnContext(req.Context(), "blocked proxied request to disallowed destination",
+					slog.String("host", host),
+					slog.String("address", ip.String()),
+				)
+				return nil, fmt.Errorf("%w: %s (%s)", ErrDestinationBlocked, host, ip)
+			}
+		}
+		return proxyURL, nil
+	}
+}
+
+func (g *destinationGuard) blocked(ip netip.Addr) bool {
+	for _, prefix := range g.allow {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefixes := range [][]netip.Prefix{blockedPrefixes, g.deny} {
+		for _, prefix := range prefixes {
+			if prefix.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
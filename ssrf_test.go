@@ -0,0 +1,182 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestWithDestinationGuard_BlocksDefaults(t *testing.T) {
+	client := newTestClient(httpx.WithDestinationGuard())
+
+	urls := []string{
+		"http://127.0.0.1:1/",
+		"http://localhost:1/",
+		"http://10.1.2.3:1/",
+		"http://172.16.0.1:1/",
+		"http://192.168.1.1:1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://100.64.0.1:1/",
+		"http://0.0.0.0:1/",
+		"http://[::1]:1/",
+		"http://[::ffff:127.0.0.1]:1/",
+		"http://[fe80::1]:1/",
+		"http://[fd00:ec2::254]/",
+		"http://192.0.0.170:1/",
+		"http://198.18.0.1:1/",
+		"http://240.0.0.1:1/",
+		"http://255.255.255.255:1/",
+		"http://[::7f00:1]:1/",
+		"http://[64:ff9b::a9fe:a9fe]/",
+		"http://[64:ff9b:1::a00:1]:1/",
+		"http://[2002:7f00:1::]:1/",
+		"http://[2001:0:4136:e378:8000:63bf:3fff:fdd2]:1/",
+		"http://[fec0::1]:1/",
+	}
+
+	for _, url := range urls {
+		t.Run(url, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			_, err := client.Do(context.Background(), req)
+			if !errors.Is(err, httpx.ErrDestinationBlocked) {
+				t.Errorf("expected ErrDestinationBlocked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDestinationGuard_AllowAndDeny(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	loopback := netip.MustParsePrefix("127.0.0.0/8")
+
+	t.Run("allow overrides defaults", func(t *testing.T) {
+		client := newTestClient(httpx.WithDestinationGuard(httpx.DestinationAllow(loopback)))
+		if _, err := getBody(t, client, server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("deny adds prefixes", func(t *testing.T) {
+		client := newTestClient(httpx.WithDestinationGuard(
+			httpx.DestinationDeny(netip.MustParsePrefix("203.0.113.0/24")),
+		))
+		req, _ := http.NewRequest(http.MethodGet, "http://203.0.113.10:1/", nil)
+		if _, err := client.Do(context.Background(), req); !errors.Is(err, httpx.ErrDestinationBlocked) {
+			t.Errorf("expected ErrDestinationBlocked, got %v", err)
+		}
+	})
+
+	t.Run("allow wins over deny", func(t *testing.T) {
+		client := newTestClient(httpx.WithDestinationGuard(
+			httpx.DestinationDeny(netip.MustParsePrefix("127.0.0.1/32")),
+			httpx.DestinationAllow(loopback),
+		))
+		if _, err := getBody(t, client, server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestWithDestinationGuard_BlocksRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithDestinationGuard(
+		httpx.DestinationAllow(netip.MustParsePrefix("127.0.0.1/32")),
+	))
+
+	if _, err := getBody(t, client, server.URL); !errors.Is(err, httpx.ErrDestinationBlocked) {
+		t.Fatalf("expected ErrDestinationBlocked, got %v", err)
+	}
+}
+
+func TestWithDestinationGuard_NotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(
+		httpx.WithRetries(3),
+		httpx.WithRetryDelay(time.Second),
+		httpx.WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				attempts.Add(1)
+				return next.RoundTrip(req)
+			})
+		}),
+		httpx.WithDestinationGuard(),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:1/", nil)
+	_, err := client.Do(context.Background(), req)
+	if !errors.Is(err, httpx.ErrDestinationBlocked) {
+		t.Fatalf("expected ErrDestinationBlocked, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Errorf("expected error to name the blocked address, got %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts.Load())
+	}
+}
+
+func TestWithDestinationGuard_Proxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	// The proxy itself runs on loopback
+	allowProxy := httpx.DestinationAllow(netip.MustParsePrefix(proxyURL.Hostname() + "/32"))
+
+	testCases := []struct {
+		name string
+		opts []httpx.ClientOption
+	}{
+		{"proxy after guard", []httpx.ClientOption{httpx.WithDestinationGuard(allowProxy), httpx.WithProxy(proxyURL)}},
+		{"proxy before guard", []httpx.ClientOption{httpx.WithProxy(proxyURL), httpx.WithDestinationGuard(allowProxy)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxied.Store(0)
+			client := newTestClient(tc.opts...)
+
+			for _, target := range []string{"http://169.254.169.254/latest/meta-data/", "http://[::1]:8080/", "http://10.1.2.3/"} {
+				req, _ := http.NewRequest(http.MethodGet, target, nil)
+				if _, err := client.Do(context.Background(), req); !errors.Is(err, httpx.ErrDestinationBlocked) {
+					t.Errorf("%s: expected ErrDestinationBlocked, got %v", target, err)
+				}
+			}
+			if proxied.Load() != 0 {
+				t.Errorf("expected no blocked request to reach the proxy, got %d", proxied.Load())
+			}
+
+			if _, err := getBody(t, client, "http://203.0.113.10/"); err != nil {
+				t.Fatalf("unexpected error for allowed destination: %v", err)
+			}
+			if proxied.Load() != 1 {
+				t.Errorf("expected allowed request to go through the proxy, got %d", proxied.Load())
+			}
+		})
+	}
+}
+
+// roundTripFunc adapts a function to an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
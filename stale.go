@@ -0,0 +1,155 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// staleWarning marks responses served from the fallback store (RFC 7234 §5.5.1)
+const staleWarning = `110 - "Response is Stale"`
+
+// StaleFallbackOption configures the fallback created by WithStaleFallback.
+type StaleFallbackOption func(*staleFallback)
+
+// StaleFallbackMaxAge stops serving stored responses older than d. By default
+// any stored response may be served.
+func StaleFallbackMaxAge(d time.Duration) StaleFallbackOption {
+	return func(f *staleFallback) { f.maxAge = d }
+}
+
+// StaleFallbackMaxEntrySize sets the largest response body that is stored (default: 10MB).
+func StaleFallbackMaxEntrySize(size int64) StaleFallbackOption {
+	return func(f *staleFallback) { f.maxEntrySize = size }
+}
+
+// WithStaleFallback records the last successful response of every GET request
+// in store. When Do exhausts its retries for a GET, either with a retryable
+// error such as a network failure or with a retryable status code, the
+// recorded response is returned instead, carrying a Warning header that
+// IsStale detects. Errors that are never retried, such as
+// ErrCertificatePinMismatch, ErrDestinationBlocked or a canceled context, are
+// returned as is. Like WithCache, responses to requests with an Authorization
+// header are only recorded when they allow a shared cache to reuse them.
+func WithStaleFallback(store CacheStore, opts ...StaleFallbackOption) ClientOption {
+	return func(c *client) {
+		f := &staleFallback{
+			store:        store,
+			maxEntrySize: defaultCacheMaxEntrySize,
+		}
+		for _, opt := range opts {
+			opt(f)
+		}
+		c.staleFallback = f
+	}
+}
+
+// IsStale reports whether resp is a stale copy served in place of a failed request.
+func IsStale(resp *http.Response) bool {
+	for _, warning := range resp.Header.Values("Warning") {
+		if strings.HasPrefix(warning, "110 ") {
+			return true
+		}
+	}
+	return false
+}
+
+type staleFallback struct {
+	store        CacheStore
+	maxAge       time.Duration
+	maxEntrySize int64
+}
+
+// applyStaleFallback records successful GET responses and replaces failed
+// ones with the last recorded response
+func (c *client) applyStaleFallback(ctx context.Context, req *http.Request, resp *http.Response, err error) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return resp, err
+	}
+
+	if err == nil && !c.shouldRetry(resp.StatusCode) {
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 && allowsAuthorizedReuse(req, parseCacheControl(resp.Header)) {
+			return c.staleFallback.record(req, resp)
+		}
+		return resp, nil
+	}
+	// Errors that are not retried, such as a pin mismatch, a blocked
+	// destination or a canceled request, are not hidden behind stale data
+	if err != nil && !isRetryableError(err) {
+		return resp, err
+	}
+
+	key := cacheKey(req)
+	entry := loadCacheEntry(c.staleFallback.store, key)
+	if entry == nil || !entry.matchesVary(req) {
+		return resp, err
+	}
+
+	now := time.Now()
+	age := entry.age(now)
+	if c.staleFallback.maxAge > 0 && age > c.staleFallback.maxAge {
+		return resp, err
+	}
+
+	attrs := []any{
+		slog.String("method", req.Method),
+		slog.String("url", c.redactor.URL(req.URL)),
+		slog.Duration("age", age),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", c.redactor.Error(err)))
+	} else {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		_ = resp.Body.Close()
+	}
+	c.Logger.WarnContext(ctx, "serving stale response after retries exhausted", attrs...)
+
+	stale := entry.response(req, now)
+	stale.Header.Add("Warning", staleWarning)
+	return stale, nil
+}
+
+// record buffers resp and stores it as the fallback for req
+func (f *staleFallback) record(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if resp.ContentLength > f.maxEntrySize {
+		return resp, nil
+	}
+
+	requestTime := time.Now()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxEntrySize+1))
+	if err != nil {
+		// Let the caller see the read error when it reads the body itself
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), errReader{err}), resp.Body}
+		return resp, nil
+	}
+	if int64(len(body)) > f.maxEntrySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	entry := newCacheEntry(req, resp, body, requestTime, time.Now())
+	entry.save(f.store, cacheKey(req))
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// errReader always fails with err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,212 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestWithStaleFallback_ServesStaleOnStatus(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("last good"))
+	}))
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	client := httpx.New(log,
+		httpx.WithRetries(2),
+		httpx.WithRetryDelay(time.Millisecond),
+		httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)),
+	)
+
+	resp, body := doGet(t, client, server.URL, nil)
+	if httpx.IsStale(resp) || body != "last good" {
+		t.Fatalf("expected fresh response, got stale=%v body='%s'", httpx.IsStale(resp), body)
+	}
+
+	failing.Store(true)
+	resp, body = doGet(t, client, server.URL, nil)
+
+	if resp.StatusCode != http.StatusOK || body != "last good" {
+		t.Errorf("expected stale 200 'last good', got %d '%s'", resp.StatusCode, body)
+	}
+	if !httpx.IsStale(resp) {
+		t.Error("expected response to be marked stale")
+	}
+	if !strings.Contains(logBuf.String(), "serving stale response") {
+		t.Error("expected stale fallback to be logged")
+	}
+}
+
+func TestWithStaleFallback_ServesStaleOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("last good"))
+	}))
+	url := server.URL
+
+	client := newTestClient(httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, url, nil)
+	server.Close()
+
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected stale response instead of error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !httpx.IsStale(resp) || string(body) != "last good" {
+		t.Errorf("expected stale 'last good', got stale=%v body='%s'", httpx.IsStale(resp), body)
+	}
+}
+
+func TestWithStaleFallback_NotForFinalErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("last good"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{"pin mismatch", fmt.Errorf("%w for example.com", httpx.ErrCertificatePinMismatch)},
+		{"blocked destination", fmt.Errorf("%w: 169.254.169.254", httpx.ErrDestinationBlocked)},
+		{"canceled", context.Canceled},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var failing atomic.Bool
+			client := newTestClient(
+				httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)),
+				httpx.WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+					return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+						if failing.Load() {
+							return nil, tc.err
+						}
+						return next.RoundTrip(req)
+					})
+				}),
+			)
+
+			doGet(t, client, server.URL, nil)
+			failing.Store(true)
+
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			resp, err := client.Do(context.Background(), req)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v instead of a stale response, got resp=%v err=%v", tc.err, resp, err)
+			}
+		})
+	}
+}
+
+func TestWithStaleFallback_NoStoredResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)))
+
+	resp, _ := doGet(t, client, server.URL, nil)
+	if resp.StatusCode != http.StatusInternalServerError || httpx.IsStale(resp) {
+		t.Errorf("expected original 500, got %d stale=%v", resp.StatusCode, httpx.IsStale(resp))
+	}
+}
+
+func TestWithStaleFallback_Authorization(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("data for " + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)))
+
+	doGet(t, client, server.URL, http.Header{"Authorization": {"Bearer alice"}})
+	failing.Store(true)
+
+	resp, body := doGet(t, client, server.URL, http.Header{"Authorization": {"Bearer bob"}})
+	if resp.StatusCode != http.StatusServiceUnavailable || httpx.IsStale(resp) || strings.Contains(body, "alice") {
+		t.Errorf("expected original 503 instead of another user's response, got %d '%s'", resp.StatusCode, body)
+	}
+}
+
+func TestWithStaleFallback_MaxAge(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("old"))
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithStaleFallback(
+		httpx.NewMemoryCacheStore(0),
+		httpx.StaleFallbackMaxAge(time.Millisecond),
+	))
+
+	doGet(t, client, server.URL, nil)
+	time.Sleep(10 * time.Millisecond)
+	failing.Store(true)
+
+	resp, _ := doGet(t, client, server.URL, nil)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected too old response not to be served, got %d", resp.StatusCode)
+	}
+}
+
+func TestWithStaleFallback_OnlyGet(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithStaleFallback(httpx.NewMemoryCacheStore(0)))
+
+	for _, fail := range []bool{false, true} {
+		failing.Store(fail)
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("data"))
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if fail && resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected POST failure to be returned as is, got %d", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package httpx
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultThrottleThreshold = 0.1
+	defaultThrottleMaxDelay  = time.Minute
+)
+
+// ThrottleOption configures adaptive throttling created by WithAdaptiveThrottling.
+type ThrottleOption func(*throttleTransport)
+
+// ThrottleThreshold sets the fraction of the advertised limit below which
+// requests start being spread out until the window resets (default: 0.1).
+func ThrottleThreshold(fraction float64) ThrottleOption {
+	return func(t *throttleTransport) { t.threshold = fraction }
+}
+
+// ThrottleMaxDelay caps how long a single request is held back (default: 1 minute).
+func ThrottleMaxDelay(d time.Duration) ThrottleOption {
+	return func(t *throttleTransport) { t.maxDelay = d }
+}
+
+// WithAdaptiveThrottling reads RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset (or their X-RateLimit-* equivalents) from responses and slows
+// down requests to the same host before the quota runs out. The state is
+// shared by all requests made by the client.
+func WithAdaptiveThrottling(opts ...ThrottleOption) ClientOption {
+	return func(c *client) {
+		t := &throttleTransport{
+			logger:    c.Logger,
+			threshold: defaultThrottleThreshold,
+			maxDelay:  defaultThrottleMaxDelay,
+			hosts:     make(map[string]*throttleState),
+		}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type throttleTransport struct {
+	next      http.RoundTripper
+	logger    *slog.Logger
+	threshold float64
+	maxDelay  time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*throttleState
+}
+
+// throttleState is the last quota advertised by a host
+type throttleState struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+
+	if delay, state := t.reserve(host); delay > 0 {
+		t.logger.InfoContext(ctx, "throttling request to stay within rate limit",
+			slog.String("host", host),
+			slog.Int("limit", state.limit),
+			slog.Int("remaining", state.remaining),
+			slog.Time("reset", state.reset),
+			slog.Duration("delay", delay),
+		)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.update(host, resp.Header)
+	return resp, nil
+}
+
+// reserve accounts for a request about to be sent to host and returns how
+// long it should be held back
+func (t *throttleTransport) reserve(host string) (time.Duration, throttleState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.hosts[host]
+	if !ok {
+		return 0, throttleState{}
+	}
+
+	now := time.Now()
+	if !now.Before(s.reset) {
+		// The window has reset, wait for the next response to learn the new quota
+		delete(t.hosts, host)
+		return 0, throttleState{}
+	}
+
+	snapshot := *s
+	untilReset := s.reset.Sub(now)
+
+	var delay time.Duration
+	switch {
+	case s.remaining <= 0:
+		delay = untilReset
+	case s.limit > 0 && float64(s.remaining) <= float64(s.limit)*t.threshold:
+		// Spread the remaining requests evenly over the rest of the window
+		delay = untilReset / time.Duration(s.remaining+1)
+	}
+	s.remaining--
+
+	if delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+	return delay, snapshot
+}
+
+// update records the quota advertised by a response
+func (t *throttleTransport) update(host string, header http.Header) {
+	limit, _ := rateLimitHeader(header, "Limit")
+	remaining, hasRemaining := rateLimitHeader(header, "Remaining")
+	reset, hasReset := rateLimitHeader(header, "Reset")
+	if !hasRemaining || !hasReset {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hosts[host] = &throttleState{
+		limit:     limit,
+		remaining: remaining,
+		reset:     parseRateLimitReset(reset),
+	}
+}
+
+// rateLimitHeader reads RateLimit-<name>, falling back to X-RateLimit-<name>
+func rateLimitHeader(header http.Header, name string) (int, bool) {
+	for _, key := range []string{"RateLimit-" + name, "X-RateLimit-" + name} {
+		value := header.Get(key)
+		if value == "" {
+			continue
+		}
+		// Draft versions allow a quota policy after the value, e.g. "100, 100;w=60"
+		if i := strings.IndexAny(value, ",;"); i >= 0 {
+			value = value[:i]
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// parseRateLimitReset converts a reset value to an absolute time. The IETF
+// draft uses delta seconds, while many X-RateLimit-Reset implementations send
+// a Unix timestamp instead.
+func parseRateLimitReset(value int) time.Time {
+	const unixThreshold = 1_000_000_000
+	if value >= unixThreshold {
+		return time.Unix(int64(value), 0)
+	}
+	return time.Now().Add(time.Duration(value) * time.Second)
+}
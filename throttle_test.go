@@ -0,0 +1,134 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+func TestWithAdaptiveThrottling_QuotaExhausted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "10")
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", "1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logBuf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(logBuf, nil))
+	client := httpx.New(log, httpx.WithAdaptiveThrottling(httpx.ThrottleMaxDelay(200*time.Millisecond)))
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		duration := time.Since(start)
+
+		if i == 0 && duration > 150*time.Millisecond {
+			t.Errorf("expected first request not to be throttled, took %v", duration)
+		}
+		if i == 1 && duration < 150*time.Millisecond {
+			t.Errorf("expected second request to be throttled, took %v", duration)
+		}
+	}
+
+	if !strings.Contains(logBuf.String(), "throttling request") {
+		t.Error("expected throttling to be logged")
+	}
+}
+
+func TestWithAdaptiveThrottling_XRateLimitHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", "1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithAdaptiveThrottling())
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// One request left in a 1s window is spread over the remaining time
+	start := time.Now()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, err = client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if duration := time.Since(start); duration < 300*time.Millisecond {
+		t.Errorf("expected request to be slowed down, took %v", duration)
+	}
+}
+
+func TestWithAdaptiveThrottling_BelowThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100")
+		w.Header().Set("RateLimit-Remaining", "90")
+		w.Header().Set("RateLimit-Reset", "60")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithAdaptiveThrottling())
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if duration := time.Since(start); duration > 200*time.Millisecond {
+		t.Errorf("expected no throttling with plenty of quota left, took %v", duration)
+	}
+}
+
+func TestWithAdaptiveThrottling_ContextExpires(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", "30")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithAdaptiveThrottling())
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(ctx, req); err == nil {
+		t.Error("expected error when the context expires while throttled")
+	}
+}
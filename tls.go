@@ -0,0 +1,184 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultCertificateReloadInterval = 30 * time.Second
+
+// WithRootCAs sets the certificate authorities used to verify servers instead
+// of the system roots.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *client) { c.tlsConfig().RootCAs = pool }
+}
+
+// WithMinTLSVersion sets the minimum TLS version, e.g. tls.VersionTLS13.
+func WithMinTLSVersion(version uint16) ClientOption {
+	return func(c *client) { c.tlsConfig().MinVersion = version }
+}
+
+// CertificateOption configures the client certificate loaded by WithClientCertificate.
+type CertificateOption func(*certReloader)
+
+// CertificateReloadInterval sets how often the certificate files are checked
+// for changes (default: 30s).
+func CertificateReloadInterval(d time.Duration) CertificateOption {
+	return func(r *certReloader) { r.interval = d }
+}
+
+// WithClientCertificate presents the PEM encoded certificate and key in
+// certFile and keyFile to servers requesting a client certificate. The files
+// are reloaded when they change on disk, so certificates rotated by a sidecar
+// are picked up without recreating the Client: new connections use the new
+// certificate while idle connections are closed and busy ones finish their
+// requests. A failed reload keeps the previous certificate.
+func WithClientCertificate(certFile, keyFile string, opts ...CertificateOption) ClientOption {
+	return func(c *client) {
+		r := &certReloader{
+			certFile:  certFile,
+			keyFile:   keyFile,
+			interval:  defaultCertificateReloadInterval,
+			logger:    c.Logger,
+			transport: c.baseTransport(),
+		}
+		for _, opt := range opts {
+			opt(r)
+		}
+
+		if err := r.reload(); err != nil {
+			c.Logger.Error("failed to load client certificate",
+				slog.String("cert_file", certFile),
+				slog.Any("error", err),
+			)
+		}
+
+		c.tlsConfig().GetClientCertificate = r.getClientCertificate
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			return &certReloadTransport{next: next, reloader: r}
+		})
+	}
+}
+
+// tlsConfig returns the TLS configuration of the base transport, creating it
+// on first use
+func (c *client) tlsConfig() *tls.Config {
+	transport := c.baseTransport()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
+
+// certReloadTransport checks the certificate files before every attempt, so a
+// rotation is noticed even while connections are reused
+type certReloadTransport struct {
+	next     http.RoundTripper
+	reloader *certReloader
+}
+
+func (t *certReloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.reloader.maybeReload()
+	return t.next.RoundTrip(req)
+}
+
+// certReloader holds the current client certificate and reloads it when the
+// modification time or size of its files changes
+type certReloader struct {
+	certFile  string
+	keyFile   string
+	interval  time.Duration
+	logger    *slog.Logger
+	transport *http.Transport
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	state   [2]fileState
+	checked time.Time
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert == nil {
+		return nil, errors.New("no client certificate loaded")
+	}
+	return r.cert, nil
+}
+
+// maybeReload reloads the certificate if the files changed since the last
+// successful load, checking at most once per interval
+func (r *certReloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.checked) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.checked = time.Now()
+	state, err := r.stat()
+	changed := err == nil && state != r.state
+	r.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		r.logger.Warn("failed to reload client certificate, keeping the previous one",
+			slog.String("cert_file", r.certFile),
+			slog.Any("error", err),
+		)
+		return
+	}
+
+	r.logger.Info("reloaded client certificate", slog.String("cert_file", r.certFile))
+	// Idle connections still present the old certificate
+	r.transport.CloseIdleConnections()
+}
+
+func (r *certReloader) reload() error {
+	state, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.state = state
+	r.checked = time.Now()
+	return nil
+}
+
+func (r *certReloader) stat() ([2]fileState, error) {
+	var state [2]fileState
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return state, fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		state[i] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return state, nil
+}
@@ -0,0 +1,266 @@
+package httpx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// testCA issues client certificates for the mTLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes a client certificate for commonName and its key to dir
+func (ca *testCA) issue(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeFileWithNewModTime(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFileWithNewModTime(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+// writeFileWithNewModTime writes data to name and moves its modification
+// time forward, so a rewrite is noticed on filesystems with coarse timestamps
+func writeFileWithNewModTime(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	var modTime time.Time
+	if info, err := os.Stat(name); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	} else {
+		modTime = time.Now()
+	}
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatalf("failed to set modification time of %s: %v", name, err)
+	}
+}
+
+// newMTLSServer requires client certificates issued by ca and answers with
+// the common name of the client certificate
+func newMTLSServer(t *testing.T, ca *testCA) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, roots
+}
+
+func getBody(t *testing.T, client httpx.Client, url string) (string, error) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), nil
+}
+
+func TestWithRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	t.Run("trusts custom pool", func(t *testing.T) {
+		roots := x509.NewCertPool()
+		roots.AddCert(server.Certificate())
+
+		if _, err := getBody(t, newTestClient(httpx.WithRootCAs(roots)), server.URL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects unknown authority", func(t *testing.T) {
+		if _, err := getBody(t, newTestClient(), server.URL); err == nil {
+			t.Fatal("expected certificate verification error")
+		}
+	})
+}
+
+func TestNew_SharesDefaultTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var calls int
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return defaultTransport.RoundTrip(req)
+	})
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	if _, err := getBody(t, newTestClient(), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a client without transport options to use http.DefaultTransport, got %d calls", calls)
+	}
+
+	if _, err := getBody(t, newTestClient(httpx.WithMinTLSVersion(tls.VersionTLS13)), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a client with TLS options to use its own transport, got %d calls", calls)
+	}
+}
+
+func TestWithMinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	if _, err := getBody(t, newTestClient(httpx.WithRootCAs(roots)), server.URL); err != nil {
+		t.Fatalf("unexpected error with default minimum version: %v", err)
+	}
+
+	client := newTestClient(httpx.WithRootCAs(roots), httpx.WithMinTLSVersion(tls.VersionTLS13))
+	if _, err := getBody(t, client, server.URL); err == nil {
+		t.Fatal("expected handshake to fail below the minimum TLS version")
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server, roots := newMTLSServer(t, ca)
+	dir := t.TempDir()
+	certFile, keyFile := ca.issue(t, dir, "client-1")
+
+	client := newTestClient(
+		httpx.WithRootCAs(roots),
+		httpx.WithClientCertificate(certFile, keyFile, httpx.CertificateReloadInterval(0)),
+	)
+
+	body, err := getBody(t, client, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body != "client-1" {
+		t.Fatalf("expected client-1, got %q", body)
+	}
+
+	t.Run("reloads rotated certificate", func(t *testing.T) {
+		ca.issue(t, dir, "client-2")
+
+		body, err := getBody(t, client, server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if body != "client-2" {
+			t.Errorf("expected client-2, got %q", body)
+		}
+	})
+
+	t.Run("keeps certificate when reload fails", func(t *testing.T) {
+		writeFileWithNewModTime(t, certFile, []byte("not a certificate"))
+
+		body, err := getBody(t, client, server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if body != "client-2" {
+			t.Errorf("expected client-2, got %q", body)
+		}
+	})
+}
+
+func TestWithClientCertificate_MissingFiles(t *testing.T) {
+	ca := newTestCA(t)
+	server, roots := newMTLSServer(t, ca)
+	dir := t.TempDir()
+
+	client := newTestClient(
+		httpx.WithRootCAs(roots),
+		httpx.WithClientCertificate(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"),
+			httpx.CertificateReloadInterval(0)),
+	)
+
+	if _, err := getBody(t, client, server.URL); err == nil {
+		t.Fatal("expected handshake to fail without a client certificate")
+	}
+
+	t.Run("loads certificate once it appears", func(t *testing.T) {
+		ca.issue(t, dir, "client-late")
+
+		body, err := getBody(t, client, server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if body != "client-late" {
+			t.Errorf("expected client-late, got %q", body)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx/logger"
+)
+
+const defaultTokenExpiryDelta = 30 * time.Second
+
+// Token is an access token sent in the Authorization header.
+type Token struct {
+	AccessToken string
+	// TokenType is the authorization scheme, "Bearer" when empty
+	TokenType string
+	// Expiry is when the token stops being valid, zero if it never expires
+	Expiry time.Time
+}
+
+func (t *Token) authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource fetches access tokens. Implementations do not need to cache
+// tokens or be safe for concurrent use, WithBearerAuth takes care of both.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// BearerAuthOption configures the middleware created by WithBearerAuth.
+type BearerAuthOption func(*bearerTransport)
+
+// BearerExpiryDelta sets how long before its expiry a token is refreshed (default: 30s).
+func BearerExpiryDelta(d time.Duration) BearerAuthOption {
+	return func(t *bearerTransport) { t.tokens.expiryDelta = d }
+}
+
+// WithBearerAuth sets the Authorization header of every attempt to a token
+// from ts. Tokens are cached until shortly before they expire and concurrent
+// callers share a single refresh. When the server answers 401 the token is
+// invalidated and the request is replayed once with a fresh token. Tokens are
+// not sent when a redirect leads to another origin.
+func WithBearerAuth(ts TokenSource, opts ...BearerAuthOption) ClientOption {
+	return func(c *client) {
+		t := &bearerTransport{
+			logger:   c.Logger,
+			redactor: c.redactor,
+			tokens:   &cachedTokenSource{source: ts, expiryDelta: defaultTokenExpiryDelta},
+		}
+		for _, opt := range opts {
+			opt(t)
+		}
+		c.middlewares = append(c.middlewares, func(next http.RoundTripper) http.RoundTripper {
+			t.next = next
+			return t
+		})
+	}
+}
+
+type bearerTransport struct {
+	next     http.RoundTripper
+	logger   *slog.Logger
+	redactor *logger.Redactor
+	tokens   *cachedTokenSource
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if isCrossOriginRedirect(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	token, err := t.tokens.token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain token: %w", err)
+	}
+
+	authReq := req.Clone(ctx)
+	authReq.Header.Set("Authorization", token.authorization())
+
+	resp, err := t.next.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Replaying needs a fresh copy of the body
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.logger.InfoContext(ctx, "token rejected, refreshing and replaying request",
+		slog.String("method", req.Method),
+		slog.String("url", t.redactor.URL(req.URL)),
+	)
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	t.tokens.invalidate(token)
+	token, err = t.tokens.token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	replayReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		if replayReq.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to replay request body: %w", err)
+		}
+	}
+	replayReq.Header.Set("Authorization", token.authorization())
+
+	return t.next.RoundTrip(replayReq)
+}
+
+// cachedTokenSource caches the token of source and makes sure only one
+// refresh runs at a time
+type cachedTokenSource struct {
+	source      TokenSource
+	expiryDelta time.Duration
+
+	mu      sync.Mutex
+	current *Token
+	refresh *tokenRefresh
+}
+
+// tokenRefresh is a refresh shared by every caller waiting for a token
+type tokenRefresh struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func (s *cachedTokenSource) token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	if s.valid(s.current) {
+		token := s.current
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	if r := s.refresh; r != nil {
+		s.mu.Unlock()
+		select {
+		case <-r.done:
+			return r.token, r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r := &tokenRefresh{done: make(chan struct{})}
+	s.refresh = r
+	s.mu.Unlock()
+
+	r.token, r.err = s.source.Token(ctx)
+	if r.err == nil && r.token == nil {
+		r.err = errors.New("token source returned no token")
+	}
+
+	s.mu.Lock()
+	if r.err == nil {
+		s.current = r.token
+	}
+	s.refresh = nil
+	s.mu.Unlock()
+	close(r.done)
+
+	return r.token, r.err
+}
+
+// invalidate drops token unless it has already been replaced
+func (s *cachedTokenSource) invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == token {
+		s.current = nil
+	}
+}
+
+func (s *cachedTokenSource) valid(token *Token) bool {
+	if token == nil {
+		return false
+	}
+	return token.Expiry.IsZero() || time.Until(token.Expiry) > s.expiryDelta
+}
@@ -0,0 +1,207 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/extosoft-devsecops/httpx"
+)
+
+// countingTokenSource hands out token-1, token-2, ... valid for ttl
+type countingTokenSource struct {
+	calls int32
+	ttl   time.Duration
+	delay time.Duration
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (*httpx.Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	time.Sleep(s.delay)
+	return &httpx.Token{
+		AccessToken: fmt.Sprintf("token-%d", n),
+		Expiry:      time.Now().Add(s.ttl),
+	}, nil
+}
+
+func TestWithBearerAuth_InjectsAndCachesToken(t *testing.T) {
+	var authHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ts := &countingTokenSource{ttl: time.Hour}
+	client := newTestClient(httpx.WithBearerAuth(ts))
+
+	for i := 0; i < 3; i++ {
+		doGet(t, client, server.URL, nil)
+	}
+
+	if n := atomic.LoadInt32(&ts.calls); n != 1 {
+		t.Errorf("expected token to be fetched once, got %d", n)
+	}
+	for _, header := range authHeaders {
+		if header != "Bearer token-1" {
+			t.Errorf("expected 'Bearer token-1', got '%s'", header)
+		}
+	}
+}
+
+func TestWithBearerAuth_RefreshesBeforeExpiry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Tokens expire within the expiry delta, so every request refreshes
+	ts := &countingTokenSource{ttl: 10 * time.Second}
+	client := newTestClient(httpx.WithBearerAuth(ts, httpx.BearerExpiryDelta(time.Minute)))
+
+	doGet(t, client, server.URL, nil)
+	doGet(t, client, server.URL, nil)
+
+	if n := atomic.LoadInt32(&ts.calls); n != 2 {
+		t.Errorf("expected 2 token fetches, got %d", n)
+	}
+}
+
+func TestWithBearerAuth_ConcurrentRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ts := &countingTokenSource{ttl: time.Hour, delay: 50 * time.Millisecond}
+	client := newTestClient(httpx.WithBearerAuth(ts))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			resp, err := client.Do(context.Background(), req)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&ts.calls); n != 1 {
+		t.Errorf("expected concurrent callers to share one refresh, got %d", n)
+	}
+}
+
+func TestWithBearerAuth_ReplaysOnUnauthorized(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		// Only the second token is accepted
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ts := &countingTokenSource{ttl: time.Hour}
+	client := newTestClient(httpx.WithBearerAuth(ts))
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 after replay, got %d", resp.StatusCode)
+	}
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("expected body to be replayed, got %q", bodies)
+	}
+}
+
+func TestWithBearerAuth_ReplaysOnlyOnce(t *testing.T) {
+	var callCount int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&callCount, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := newTestClient(httpx.WithBearerAuth(&countingTokenSource{ttl: time.Hour}))
+
+	resp, _ := doGet(t, client, server.URL, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(&callCount); n != 2 {
+		t.Errorf("expected exactly one replay, got %d calls", n)
+	}
+}
+
+func TestWithBearerAuth_TokenSourceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sourceErr := errors.New("identity provider down")
+	client := newTestClient(httpx.WithBearerAuth(httpx.TokenSourceFunc(func(ctx context.Context) (*httpx.Token, error) {
+		return nil, sourceErr
+	})))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(context.Background(), req); !errors.Is(err, sourceErr) {
+		t.Errorf("expected token source error, got %v", err)
+	}
+}
+
+func TestWithBearerAuth_NotSentToOtherOrigin(t *testing.T) {
+	var otherAuth, sameAuth atomic.Value
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherAuth.Store(r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-origin":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/target":
+			sameAuth.Store(r.Header.Get("Authorization"))
+		case "/other-origin":
+			http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	// The default redirect policy must not forward the token either
+	client := newTestClient(httpx.WithBearerAuth(&countingTokenSource{ttl: time.Hour}))
+
+	doGet(t, client, server.URL+"/same-origin", nil)
+	if got := sameAuth.Load(); got != "Bearer token-1" {
+		t.Errorf("expected token on same origin redirect, got %q", got)
+	}
+
+	doGet(t, client, server.URL+"/other-origin", nil)
+	if got := otherAuth.Load(); got != "" {
+		t.Errorf("expected no token on other origin, got %q", got)
+	}
+}